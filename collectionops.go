@@ -0,0 +1,187 @@
+package golaxy
+
+import (
+	"errors"
+)
+
+// Ids of galaxy built-in collection operation tools
+const (
+	FILTER_FAILED_TOOL = "__FILTER_FAILED_DATASETS__"
+	FILTER_EMPTY_TOOL  = "__FILTER_EMPTY_DATASETS__"
+	FLATTEN_TOOL       = "__FLATTEN__"
+	ZIP_TOOL           = "__ZIP_COLLECTION__"
+	UNZIP_TOOL         = "__UNZIP_COLLECTION__"
+	RELABEL_TOOL       = "__RELABEL_FROM_FILE__"
+	SORTLIST_TOOL      = "__SORTLIST__"
+)
+
+// Sort orders of SortCollection
+const (
+	SORT_ALPHA   = "alpha"
+	SORT_NUMERIC = "numeric"
+)
+
+// Removes the failed datasets from the collection defined by its id.
+//
+// Returns the id of the new collection
+func (g *Galaxy) FilterFailedDatasets(historyid, hdcaid string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, FILTER_FAILED_TOOL)
+
+	tl.AddCollectionInput("input", hdcaid)
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Removes the empty datasets from the collection defined by its id.
+//
+// Returns the id of the new collection
+func (g *Galaxy) FilterEmptyDatasets(historyid, hdcaid string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, FILTER_EMPTY_TOOL)
+
+	tl.AddCollectionInput("input", hdcaid)
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Flattens the nested collection (list:paired, list:list, etc.) defined by its id
+// into a list. Identifiers of nested elements are joined with joinidentifier
+// ("_", ":" or "-").
+//
+// Returns the id of the new collection
+func (g *Galaxy) FlattenCollection(historyid, hdcaid, joinidentifier string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, FLATTEN_TOOL)
+
+	tl.AddCollectionInput("input", hdcaid)
+	tl.AddParameter("join_identifier", joinidentifier)
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Builds a paired collection from the two datasets defined by their ids.
+//
+// Returns the id of the new collection
+func (g *Galaxy) ZipDatasets(historyid, forwardid, reverseid string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, ZIP_TOOL)
+
+	tl.AddFileInput("input_forward", forwardid, "hda")
+	tl.AddFileInput("input_reverse", reverseid, "hda")
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Builds a list:paired collection from the two lists defined by their ids:
+// The elements of both lists are paired in order.
+//
+// Returns the id of the new collection
+func (g *Galaxy) ZipCollections(historyid, forwardid, reverseid string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, ZIP_TOOL)
+	var answer toolResponse
+
+	tl.AddBatchCollectionInput("input_forward", forwardid)
+	tl.AddBatchCollectionInput("input_reverse", reverseid)
+
+	if answer, err = g.launchTool(tl); err != nil {
+		return
+	}
+	return findOutputCollection(answer.Implicit_collections, ZIP_TOOL, "output")
+}
+
+// Splits the paired collection defined by its id into its two datasets.
+//
+// Returns the ids of the forward and reverse datasets
+func (g *Galaxy) UnzipCollection(historyid, hdcaid string) (forwardid, reverseid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, UNZIP_TOOL)
+	var answer toolResponse
+
+	tl.AddCollectionInput("input", hdcaid)
+
+	if answer, err = g.launchTool(tl); err != nil {
+		return
+	}
+
+	for _, o := range answer.Outputs {
+		switch o.Output_Name {
+		case "forward":
+			forwardid = o.Id
+		case "reverse":
+			reverseid = o.Id
+		}
+	}
+	if forwardid == "" || reverseid == "" {
+		err = errors.New("No forward/reverse outputs returned by " + UNZIP_TOOL)
+	}
+	return
+}
+
+// Relabels the elements of the collection defined by its id, using the
+// dataset defined by labelsid:
+//   - if tabular is false: one new label per line, in the order of the elements
+//   - if tabular is true: two columns, old label and new label
+//
+// If strict is true, the tool fails if some elements are not relabeled.
+//
+// Returns the id of the new collection
+func (g *Galaxy) RelabelCollection(historyid, hdcaid, labelsid string, tabular, strict bool) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, RELABEL_TOOL)
+	var how string = "txt"
+
+	if tabular {
+		how = "tabular"
+	}
+
+	tl.AddCollectionInput("input", hdcaid)
+	tl.AddParameter("how|how_select", how)
+	tl.AddFileInput("how|labels", labelsid, "hda")
+	tl.Inputs["how|strict"] = strict
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Sorts the elements of the collection defined by its id, by their
+// identifiers, with the given order (SORT_ALPHA or SORT_NUMERIC).
+//
+// Returns the id of the new collection
+func (g *Galaxy) SortCollection(historyid, hdcaid, sorttype string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, SORTLIST_TOOL)
+
+	if sorttype != SORT_ALPHA && sorttype != SORT_NUMERIC {
+		err = errors.New("Unknown sort type: " + sorttype)
+		return
+	}
+
+	tl.AddCollectionInput("input", hdcaid)
+	tl.AddParameter("sort_type|sort_type", sorttype)
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Sorts the elements of the collection defined by its id, following the
+// order of the identifiers given in the dataset defined by sortfileid
+// (one identifier per line).
+//
+// Returns the id of the new collection
+func (g *Galaxy) SortCollectionFromFile(historyid, hdcaid, sortfileid string) (newhdcaid string, err error) {
+	var tl *ToolLaunch = g.NewToolLauncher(historyid, SORTLIST_TOOL)
+
+	tl.AddCollectionInput("input", hdcaid)
+	tl.AddParameter("sort_type|sort_type", "file")
+	tl.AddFileInput("sort_type|sort_file", sortfileid, "hda")
+	return g.launchCollectionOperation(tl, "output")
+}
+
+// Launches a collection operation tool and returns the id of
+// its output collection having the given name
+func (g *Galaxy) launchCollectionOperation(tl *ToolLaunch, outputname string) (hdcaid string, err error) {
+	var answer toolResponse
+
+	if answer, err = g.launchTool(tl); err != nil {
+		return
+	}
+	return findOutputCollection(answer.Output_collections, tl.Tool_id, outputname)
+}
+
+// Returns the id of the collection having the given output name
+func findOutputCollection(collections []toolOutputCollection, toolid, outputname string) (hdcaid string, err error) {
+	for _, c := range collections {
+		if c.Output_name == outputname {
+			hdcaid = c.Id
+			return
+		}
+	}
+	err = errors.New("No output collection " + outputname + " returned by " + toolid)
+	return
+}
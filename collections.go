@@ -0,0 +1,511 @@
+package golaxy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Element of a dataset collection to upload (see UploadCollection):
+// either a local file (Path) or a nested collection (Elements).
+type CollectionUploadElement struct {
+	Identifier string                    // Element identifier ("forward"/"reverse" in paired collections)
+	Path       string                    // Local file to upload
+	Elements   []CollectionUploadElement // Elements of the nested collection
+}
+
+// Pattern used to pair forward and reverse files (see PairFiles)
+type PairingPattern struct {
+	Forward string // "_R1" for example
+	Reverse string // "_R2" for example
+}
+
+// Default patterns used to pair forward and reverse files
+var DEFAULT_PAIRING_PATTERNS = []PairingPattern{
+	{"_R1", "_R2"},
+	{"_1", "_2"},
+}
+
+// Uploads the given local files to the galaxy instance in the history defined
+// by its id, and builds a new dataset collection of the given type with them
+// ("list", "paired", "list:paired", etc.).
+//
+// The structure of the elements must correspond to the collection type: For
+// "list:paired" collections, each element is a nested collection having a
+// "forward" and a "reverse" element (see PairFiles).
+//
+// opts may be nil, default options are used in that case. Options apply to
+// all the datasets, except opts.Name that is the name of the collection.
+// The type of the datasets is opts.Ext ("auto" by default).
+//
+// Returns the collection id (hdca id), the job id and a potential error
+func (g *Galaxy) UploadCollection(historyid string, files []CollectionUploadElement, collectionType string, opts *UploadOptions) (hdcaid, jobid string, err error) {
+	var elements []fetchElement
+	var fetchfiles []fetchFile
+	var opened []*os.File
+	var answer toolResponse
+	var elementopts UploadOptions
+	var name string
+
+	if historyid == "" {
+		err = errors.New("UploadCollection input history id is not valid")
+		return
+	}
+
+	if err = checkCollectionUploadElements(files, strings.Split(collectionType, ":")); err != nil {
+		return
+	}
+
+	if opts != nil {
+		elementopts = *opts
+		name = opts.Name
+	}
+	// Dataset names are element identifiers
+	elementopts.Name = ""
+	if elementopts.Ext == "" {
+		elementopts.Ext = "auto"
+	}
+
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+
+	// Files are given to the server in the order of the depth first traversal
+	// of the elements, as expected by the data fetch entry point
+	var build func(elements []CollectionUploadElement) ([]fetchElement, error)
+	build = func(elements []CollectionUploadElement) (fetchelements []fetchElement, err error) {
+		fetchelements = make([]fetchElement, 0, len(elements))
+		for _, e := range elements {
+			var element fetchElement
+			var file *os.File
+
+			if len(e.Elements) > 0 {
+				element.Name = e.Identifier
+				if element.Elements, err = build(e.Elements); err != nil {
+					return
+				}
+			} else {
+				element = newFetchElement("files", elementopts.Ext, &elementopts)
+				element.Name = e.Identifier
+				if file, err = os.Open(e.Path); err != nil {
+					return
+				}
+				opened = append(opened, file)
+				fetchfiles = append(fetchfiles, newFetchFile(filepath.Base(e.Path), file, elementopts.Progress))
+			}
+			fetchelements = append(fetchelements, element)
+		}
+		return
+	}
+
+	if elements, err = build(files); err != nil {
+		return
+	}
+
+	if answer, err = g.fetchMultipart(historyid, []fetchTarget{{
+		Destination:     fetchDestination{"hdca"},
+		Elements:        elements,
+		Collection_type: collectionType,
+		Name:            name,
+	}}, fetchfiles); err != nil {
+		return
+	}
+
+	if len(answer.Output_collections) != 1 {
+		err = errors.New("Error while uploading the collection : Number of Output collections")
+		return
+	}
+	hdcaid = answer.Output_collections[0].Id
+
+	if len(answer.Jobs) != 1 {
+		err = errors.New("Error while uploading the collection : Number of Jobs")
+		return
+	}
+	jobid = answer.Jobs[0].Id
+	return
+}
+
+// Identifier of a collection element, and whether it is a nested collection
+// or a dataset (see checkCollectionLevel)
+type collectionElementShape struct {
+	identifier string
+	nested     bool
+}
+
+// Checks that the elements of one level of a collection correspond to the
+// given collection type (split by ":"): identifiers must be given and unique,
+// elements must be nested collections if the type has several levels and
+// datasets otherwise, and paired collections must have exactly a forward and
+// a reverse element.
+//
+// Nested elements are checked by the callers, against types[1:].
+func checkCollectionLevel(shapes []collectionElementShape, types []string) (err error) {
+	var identifiers map[string]bool = make(map[string]bool)
+
+	if len(shapes) == 0 {
+		return errors.New("Collection " + strings.Join(types, ":") + " has no element")
+	}
+
+	for _, s := range shapes {
+		if s.identifier == "" {
+			return errors.New("Element of collection " + strings.Join(types, ":") + " has no identifier")
+		}
+		if identifiers[s.identifier] {
+			return errors.New("Duplicate element identifier " + s.identifier)
+		}
+		identifiers[s.identifier] = true
+
+		if len(types) > 1 && !s.nested {
+			return errors.New("Element " + s.identifier + " must be a nested collection of type " + strings.Join(types[1:], ":"))
+		}
+		if len(types) == 1 && s.nested {
+			return errors.New("Element " + s.identifier + " must be a dataset")
+		}
+	}
+
+	if types[0] == "paired" && (len(shapes) != 2 || !identifiers["forward"] || !identifiers["reverse"]) {
+		return errors.New("Paired collections must have exactly a forward and a reverse element")
+	}
+	return
+}
+
+// Checks that the structure of the given elements corresponds to the given
+// collection type (split by ":")
+func checkCollectionUploadElements(elements []CollectionUploadElement, types []string) (err error) {
+	var shapes []collectionElementShape = make([]collectionElementShape, 0, len(elements))
+
+	for _, e := range elements {
+		if (len(e.Elements) > 0) == (e.Path != "") {
+			return errors.New("Element " + e.Identifier + " must have either a Path or Elements")
+		}
+		shapes = append(shapes, collectionElementShape{e.Identifier, len(e.Elements) > 0})
+	}
+	if err = checkCollectionLevel(shapes, types); err != nil {
+		return
+	}
+
+	for _, e := range elements {
+		if len(e.Elements) > 0 {
+			if err = checkCollectionUploadElements(e.Elements, types[1:]); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Groups the given files by pairs of forward and reverse files, located
+// in the same directory, whose base names differ only by the forward and
+// reverse patterns (sample1_R1.fastq.gz and sample1_R2.fastq.gz for example).
+//
+// Patterns are tried in the given order (DEFAULT_PAIRING_PATTERNS if nil), the
+// last occurrence of the pattern in the base name being considered.
+//
+// Returns the pairs, as elements of a "list:paired" collection (see
+// UploadCollection) sorted by identifier: the identifier of a pair is the base
+// name of its files without the pattern and the extensions (sample1 for
+// example). Files that could not be paired are returned in unpaired, as well
+// as the files of pairs having the same identifier (same sample in several
+// directories).
+func PairFiles(paths []string, patterns []PairingPattern) (pairs []CollectionUploadElement, unpaired []string) {
+	var remaining map[string]string = make(map[string]string) // key: path, value: base name
+	var candidates []CollectionUploadElement
+	var identifiers map[string]int = make(map[string]int)
+
+	if patterns == nil {
+		patterns = DEFAULT_PAIRING_PATTERNS
+	}
+
+	for _, p := range paths {
+		remaining[p] = filepath.Base(p)
+	}
+
+	for _, pattern := range patterns {
+		if pattern.Forward == "" || pattern.Forward == pattern.Reverse {
+			continue
+		}
+		for _, forward := range sortedKeys(remaining) {
+			var name, reverse string
+			var ok bool
+			var index int
+
+			if name, ok = remaining[forward]; !ok {
+				continue
+			}
+			if index = strings.LastIndex(name, pattern.Forward); index < 0 {
+				continue
+			}
+			reversename := name[:index] + pattern.Reverse + name[index+len(pattern.Forward):]
+			reverse = forward[:len(forward)-len(name)] + reversename
+			if _, ok = remaining[reverse]; !ok || reverse == forward {
+				continue
+			}
+			suffix := name[index+len(pattern.Forward):]
+			if dot := strings.Index(suffix, "."); dot >= 0 {
+				suffix = suffix[:dot]
+			}
+			candidates = append(candidates, CollectionUploadElement{
+				Identifier: name[:index] + suffix,
+				Elements: []CollectionUploadElement{
+					{Identifier: "forward", Path: forward},
+					{Identifier: "reverse", Path: reverse},
+				},
+			})
+			identifiers[name[:index]+suffix]++
+			delete(remaining, forward)
+			delete(remaining, reverse)
+		}
+	}
+
+	pairs = make([]CollectionUploadElement, 0, len(candidates))
+	for _, c := range candidates {
+		if identifiers[c.Identifier] > 1 {
+			remaining[c.Elements[0].Path] = c.Elements[0].Identifier
+			remaining[c.Elements[1].Path] = c.Elements[1].Identifier
+			continue
+		}
+		pairs = append(pairs, c)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Identifier < pairs[j].Identifier })
+
+	unpaired = sortedKeys(remaining)
+	return
+}
+
+func sortedKeys(m map[string]string) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Dataset collection of an history (hdca)
+type DatasetCollection struct {
+	Id              string              `json:"id"`
+	Hid             int                 `json:"hid"`
+	Name            string              `json:"name"`
+	History_id      string              `json:"history_id"`
+	Collection_type string              `json:"collection_type"` // "list", "paired", "list:paired", etc.
+	Populated_state string              `json:"populated_state"` // "ok" when all the elements are known
+	Element_count   int                 `json:"element_count"`
+	Elements        []CollectionElement `json:"elements"`
+	Deleted         bool                `json:"deleted"`
+	Visible         bool                `json:"visible"`
+	Model_class     string              `json:"model_class"`
+	Err_msg         string              `json:"err_msg"`  // In case of error, this field is !=""
+	Err_code        int                 `json:"err_code"` // In case of error, this field is !=0
+}
+
+// Element of a dataset collection
+type CollectionElement struct {
+	Id                 string                  `json:"id"`
+	Element_identifier string                  `json:"element_identifier"`
+	Element_index      int                     `json:"element_index"`
+	Element_type       string                  `json:"element_type"` // "hda" or "dataset_collection"
+	Object             CollectionElementObject `json:"object"`
+}
+
+// Object of a collection element: a dataset if the element type
+// is "hda", or a nested collection if it is "dataset_collection"
+type CollectionElementObject struct {
+	Id              string              `json:"id"`
+	Model_class     string              `json:"model_class"` // "HistoryDatasetAssociation" or "DatasetCollection"
+	Name            string              `json:"name"`        // Dataset only
+	State           string              `json:"state"`       // Dataset only
+	File_ext        string              `json:"file_ext"`    // Dataset only
+	File_size       int64               `json:"file_size"`   // Dataset only
+	Genome_build    string              `json:"genome_build"`
+	Collection_type string              `json:"collection_type"` // Nested collection only
+	Populated_state string              `json:"populated_state"` // Nested collection only
+	Element_count   int                 `json:"element_count"`   // Nested collection only
+	Elements        []CollectionElement `json:"elements"`        // Nested collection only
+}
+
+// Element of a flattened dataset collection (see DatasetCollection.FlattenElements)
+type FlatCollectionElement struct {
+	Identifiers []string                // Identifiers of the element and its parent collections, from the root
+	Dataset     CollectionElementObject // Dataset of the element
+}
+
+// Returns the dataset collection defined by its id (hdca id), with
+// all its elements, recursively.
+func (g *Galaxy) GetCollection(hdcaid string) (collection DatasetCollection, err error) {
+	var url string = g.url + DATASET_COLLECTIONS + "/" + hdcaid + "?instance_type=history"
+
+	if err = g.galaxyGetRequestJSON(url, &collection); err != nil {
+		return
+	}
+
+	if collection.Err_code != 0 || collection.Err_msg != "" {
+		err = errors.New(collection.Err_msg)
+	}
+	return
+}
+
+// Returns all the datasets of the collection, recursively, in the order
+// of the collection elements, with the identifiers of their elements.
+func (c *DatasetCollection) FlattenElements() (elements []FlatCollectionElement) {
+	elements = make([]FlatCollectionElement, 0, len(c.Elements))
+	elements = flattenCollectionElements(c.Elements, nil, elements)
+	return
+}
+
+// Returns all the datasets of the collection, recursively, as a map
+// with key: identifiers of the element and its parent collections joined by
+// the given separator ("sample1/forward" with "/" for example), value:
+// dataset id
+func (c *DatasetCollection) Flatten(separator string) (datasets map[string]string) {
+	datasets = make(map[string]string)
+	for _, e := range c.FlattenElements() {
+		datasets[strings.Join(e.Identifiers, separator)] = e.Dataset.Id
+	}
+	return
+}
+
+func flattenCollectionElements(elements []CollectionElement, parents []string, flat []FlatCollectionElement) []FlatCollectionElement {
+	for _, e := range elements {
+		identifiers := make([]string, len(parents)+1)
+		copy(identifiers, parents)
+		identifiers[len(parents)] = e.Element_identifier
+		if e.Element_type == "dataset_collection" {
+			flat = flattenCollectionElements(e.Object.Elements, identifiers, flat)
+		} else {
+			flat = append(flat, FlatCollectionElement{identifiers, e.Object})
+		}
+	}
+	return flat
+}
+
+// Specification of a dataset collection to build from existing datasets
+// (see CreateCollection)
+type CollectionSpec struct {
+	Name              string                  // Name of the collection
+	Collection_type   string                  // "list", "paired", "list:paired", etc.
+	Elements          []CollectionSpecElement // Elements of the collection
+	Hide_source_items bool                    // Hides the datasets used as elements in the history
+	Copy_elements     bool                    // Copies the datasets instead of referencing them
+}
+
+// Element of a CollectionSpec: either an existing dataset or collection
+// (Id), or a new nested collection (Elements).
+type CollectionSpecElement struct {
+	Identifier string                  // Element identifier ("forward"/"reverse" in paired collections)
+	Id         string                  // Id of the existing dataset (or collection)
+	Src        string                  // "hda" (default): Id is a dataset, "hdca": Id is a collection
+	Elements   []CollectionSpecElement // Elements of the new nested collection
+}
+
+// Request to create a dataset collection in an history
+type collectionRequest struct {
+	Type                string                   `json:"type"` // "dataset_collection"
+	Collection_type     string                   `json:"collection_type"`
+	Name                string                   `json:"name"`
+	Element_identifiers []collectionElementIdent `json:"element_identifiers"`
+	Hide_source_items   bool                     `json:"hide_source_items"`
+	Copy_elements       bool                     `json:"copy_elements"`
+}
+
+// Element of a collection creation request
+type collectionElementIdent struct {
+	Name                string                   `json:"name"`
+	Src                 string                   `json:"src"` // "hda", "hdca" or "new_collection"
+	Id                  string                   `json:"id,omitempty"`
+	Collection_type     string                   `json:"collection_type,omitempty"`     // If Src=="new_collection"
+	Element_identifiers []collectionElementIdent `json:"element_identifiers,omitempty"` // If Src=="new_collection"
+}
+
+// Creates a new dataset collection in the history defined by its id, from
+// existing datasets, as described by the given specification.
+//
+// The structure of the elements must correspond to the collection type: For
+// "list:paired" collections for example, each element is a nested collection
+// having a "forward" and a "reverse" element.
+//
+// Returns the id of the new collection (hdca id)
+func (g *Galaxy) CreateCollection(historyid string, spec CollectionSpec) (hdcaid string, err error) {
+	var url string = g.url + HISTORY + "/" + historyid + "/contents"
+	var request collectionRequest
+	var input []byte
+	var answer DatasetCollection
+
+	if historyid == "" {
+		err = errors.New("CreateCollection input history id is not valid")
+		return
+	}
+
+	request = collectionRequest{
+		Type:              "dataset_collection",
+		Collection_type:   spec.Collection_type,
+		Name:              spec.Name,
+		Hide_source_items: spec.Hide_source_items,
+		Copy_elements:     spec.Copy_elements,
+	}
+	if request.Element_identifiers, err = collectionElementIdents(spec.Elements, strings.Split(spec.Collection_type, ":")); err != nil {
+		return
+	}
+
+	if input, err = json.Marshal(request); err != nil {
+		return
+	}
+
+	if err = g.galaxyPostRequestJSON(url, input, &answer); err != nil {
+		return
+	}
+
+	if answer.Err_code != 0 || answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+		return
+	}
+	hdcaid = answer.Id
+	return
+}
+
+// Converts the given elements to elements of a collection creation request,
+// and checks that their structure corresponds to the given collection type
+// (split by ":")
+func collectionElementIdents(elements []CollectionSpecElement, types []string) (idents []collectionElementIdent, err error) {
+	var shapes []collectionElementShape = make([]collectionElementShape, 0, len(elements))
+
+	idents = make([]collectionElementIdent, 0, len(elements))
+	for _, e := range elements {
+		var ident collectionElementIdent = collectionElementIdent{Name: e.Identifier}
+
+		switch {
+		case len(e.Elements) > 0 && e.Id == "":
+			ident.Src = "new_collection"
+		case len(e.Elements) == 0 && e.Id != "":
+			if ident.Src = e.Src; ident.Src == "" {
+				ident.Src = "hda"
+			} else if ident.Src != "hda" && ident.Src != "hdca" {
+				err = errors.New("Element " + e.Identifier + " has an invalid Src " + e.Src + ", must be hda or hdca")
+				return
+			}
+			ident.Id = e.Id
+		default:
+			err = errors.New("Element " + e.Identifier + " must have either an Id or Elements")
+			return
+		}
+		shapes = append(shapes, collectionElementShape{e.Identifier, ident.Src != "hda"})
+		idents = append(idents, ident)
+	}
+	if err = checkCollectionLevel(shapes, types); err != nil {
+		return
+	}
+
+	for i, e := range elements {
+		if idents[i].Src == "new_collection" {
+			idents[i].Collection_type = strings.Join(types[1:], ":")
+			if idents[i].Element_identifiers, err = collectionElementIdents(e.Elements, types[1:]); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
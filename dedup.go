@@ -0,0 +1,135 @@
+package golaxy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Lists the datasets (and collections) of the history defined by its id,
+// with their hashes.
+func (g *Galaxy) ListHistoryContents(historyid string) (contents []DatasetInfo, err error) {
+	var url string = g.url + HISTORY + "/" + historyid + "/contents?v=dev&keys=id,hid,name,history_id,state,file_ext,file_size,deleted,purged,visible,history_content_type,hashes"
+
+	err = g.galaxyGetRequestJSONList(url, &contents, "Error while listing history contents")
+	return
+}
+
+// Copies the dataset defined by its id into the history defined by its id
+//
+// Returns the id of the new dataset
+func (g *Galaxy) CopyDataset(historyid, datasetid string) (newid string, err error) {
+	var url string = g.url + HISTORY + "/" + historyid + "/contents"
+	var input []byte
+	var answer DatasetInfo
+
+	if input, err = json.Marshal(map[string]string{
+		"source":  "hda",
+		"content": datasetid,
+		"type":    "dataset",
+	}); err != nil {
+		return
+	}
+
+	if err = g.galaxyPostRequestJSON(url, input, &answer); err != nil {
+		return
+	}
+
+	if answer.Err_code != 0 || answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+		return
+	}
+	newid = answer.Id
+	return
+}
+
+// Uploads the given file, unless a dataset with the same content is found
+// in opts.Cache_history (or in the target history). See UploadOptions.Deduplicate.
+func (g *Galaxy) uploadFileDeduplicated(historyid, path, ftype string, opts *UploadOptions) (fileid, jobid string, err error) {
+	var hash, cache, duplicate string
+	var size int64
+	var file *os.File
+
+	if cache = opts.Cache_history; cache == "" {
+		cache = historyid
+	}
+
+	if hash, size, err = fileSHA1(path); err != nil {
+		return
+	}
+
+	if duplicate, err = g.findDuplicateDataset(cache, hash, size); err != nil {
+		return
+	}
+
+	if duplicate != "" {
+		if cache == historyid {
+			fileid = duplicate
+		} else {
+			fileid, err = g.CopyDataset(historyid, duplicate)
+		}
+		return
+	}
+
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+	defer file.Close()
+
+	if fileid, jobid, err = g.uploadReader(historyid, filepath.Base(path), file, ftype, opts, []DatasetHash{{"SHA-1", hash}}); err != nil {
+		return
+	}
+
+	// The new dataset is made available for the next uploads. This is best
+	// effort: The upload itself succeeded, so a failed copy is not reported.
+	if cache != historyid {
+		g.CopyDataset(cache, fileid)
+	}
+	return
+}
+
+// Searches the history defined by its id for a dataset in state "ok" having
+// the given SHA-1 hash and size. Datasets without stored hash are ignored.
+//
+// Returns the id of the dataset, "" if none is found.
+func (g *Galaxy) findDuplicateDataset(historyid, hash string, size int64) (datasetid string, err error) {
+	var contents []DatasetInfo
+
+	if contents, err = g.ListHistoryContents(historyid); err != nil {
+		return
+	}
+
+	for _, d := range contents {
+		if d.History_content_type != "dataset" || d.Deleted || d.Purged || d.State != "ok" || d.File_size != size {
+			continue
+		}
+		for _, h := range d.Hashes {
+			if h.Hash_function == "SHA-1" && h.Hash_value == hash {
+				datasetid = d.Id
+				return
+			}
+		}
+	}
+	return
+}
+
+// Computes the SHA-1 hash (hex encoded) and the size of the given file
+func fileSHA1(path string) (hash string, size int64, err error) {
+	var file *os.File
+	var h = sha1.New()
+
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+	defer file.Close()
+
+	if size, err = io.Copy(h, file); err != nil {
+		return
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+	return
+}
@@ -0,0 +1,240 @@
+package golaxy
+
+import (
+	"errors"
+	"io"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Informations about a dataset of an history
+type DatasetInfo struct {
+	Id                   string        `json:"id"`
+	Hid                  int           `json:"hid"`
+	Name                 string        `json:"name"`
+	History_id           string        `json:"history_id"`
+	State                string        `json:"state"`
+	File_ext             string        `json:"file_ext"`
+	File_size            int64         `json:"file_size"`
+	Genome_build         string        `json:"genome_build"`
+	Misc_info            string        `json:"misc_info"`
+	Uuid                 string        `json:"uuid"`
+	Visible              bool          `json:"visible"`
+	Deleted              bool          `json:"deleted"`
+	Purged               bool          `json:"purged"`
+	Model_class          string        `json:"model_class"`
+	History_content_type string        `json:"history_content_type"` // "dataset" or "dataset_collection"
+	Hashes               []DatasetHash `json:"hashes"`               // Hashes of the content, if computed by the server
+	Err_msg              string        `json:"err_msg"`              // In case of error, this field is !=""
+	Err_code             int           `json:"err_code"`             // In case of error, this field is !=0
+}
+
+// Hash of the content of a dataset
+type DatasetHash struct {
+	Hash_function string `json:"hash_function"` // "MD5", "SHA-1", "SHA-256" or "SHA-512"
+	Hash_value    string `json:"hash_value"`
+}
+
+// A file or directory in the extra files of a dataset
+// (composite datatypes like html reports, shapefiles, etc.)
+type ExtraFile struct {
+	Class string `json:"class"` // "File" or "Directory"
+	Path  string `json:"path"`  // Path relative to the extra files directory of the dataset
+}
+
+// Returns the informations about the dataset defined by its id in the given history
+func (g *Galaxy) GetDataset(historyid, datasetid string) (dataset DatasetInfo, err error) {
+	var url string = g.url + HISTORY + "/" + historyid + "/contents/" + datasetid
+
+	if err = g.galaxyGetRequestJSON(url, &dataset); err != nil {
+		return
+	}
+
+	if dataset.Err_code != 0 || dataset.Err_msg != "" {
+		err = errors.New(dataset.Err_msg)
+	}
+	return
+}
+
+// Lists the extra files of the dataset defined by its id in the given history.
+//
+// Only composite datasets (html reports, shapefiles, etc.) have extra files.
+func (g *Galaxy) ListExtraFiles(historyid, datasetid string) (files []ExtraFile, err error) {
+	var url string = g.url + HISTORY + "/" + historyid + "/contents/" + datasetid + "/extra_files"
+
+	err = g.galaxyGetRequestJSONList(url, &files, "Error while listing extra files")
+	return
+}
+
+// Downloads the dataset defined by its id in the given history together with
+// its extra files, as an archive, and writes it to w.
+//
+// The format ("zip", "tgz" or "tbz") is requested to the server, that builds
+// the archive. Recent galaxy releases only build zip archives, whatever the
+// requested format. Datasets without extra files are not archived: their
+// content is written as is.
+func (g *Galaxy) DownloadExtraFilesArchive(historyid, datasetid, format string, w io.Writer) (err error) {
+	var url string
+
+	if format != "zip" && format != "tgz" && format != "tbz" {
+		err = errors.New("Unsupported archive format " + format + ", must be zip, tgz or tbz")
+		return
+	}
+	url = g.url + HISTORY + "/" + historyid + "/contents/" + datasetid + "/display?to_ext=" + format + "&do_action=" + format
+
+	err = g.galaxyGetRequestWriter(url, w)
+	return
+}
+
+// Downloads the dataset defined by its id in the given history together with
+// its extra files into the given local directory.
+//
+// The primary file is named after the dataset name (and its extension),
+// and the extra files keep their relative paths, so that links from the
+// primary file (html reports for example) are not broken.
+//
+// Returns the paths of all the written files.
+func (g *Galaxy) DownloadExtraFiles(historyid, datasetid, dir string) (paths []string, err error) {
+	var dataset DatasetInfo
+	var extrafiles []ExtraFile
+	var baseurl string = g.url + HISTORY + "/" + historyid + "/contents/" + datasetid + "/display"
+	var path string
+
+	if dataset, err = g.GetDataset(historyid, datasetid); err != nil {
+		return
+	}
+	if extrafiles, err = g.ListExtraFiles(historyid, datasetid); err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	paths = make([]string, 0, len(extrafiles)+1)
+
+	path = filepath.Join(dir, datasetFileName(dataset.Name, dataset.File_ext))
+	if err = g.downloadToFile(baseurl, path); err != nil {
+		return
+	}
+	paths = append(paths, path)
+
+	for _, f := range extrafiles {
+		if path, err = safeJoin(dir, f.Path); err != nil {
+			return
+		}
+		if f.Class == "Directory" {
+			if err = os.MkdirAll(path, 0755); err != nil {
+				return
+			}
+			continue
+		}
+		if err = g.downloadToFile(baseurl+"?filename="+neturl.QueryEscape(f.Path), path); err != nil {
+			return
+		}
+		paths = append(paths, path)
+	}
+	return
+}
+
+// Downloads the content of the given url into the given local file.
+//
+// Parent directories are created if needed.
+func (g *Galaxy) downloadToFile(url, path string) (err error) {
+	var file *os.File
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	if file, err = os.Create(path); err != nil {
+		return
+	}
+	if err = g.galaxyGetRequestWriter(url, file); err != nil {
+		file.Close()
+		return
+	}
+	err = file.Close()
+	return
+}
+
+// Builds a local file name from a dataset name and its extension
+//
+// Path separators are replaced by "_", and the extension is added
+// if the name does not already end with it.
+func datasetFileName(name, ext string) (filename string) {
+	filename = strings.Replace(name, "/", "_", -1)
+	filename = strings.Replace(filename, "\\", "_", -1)
+	if filename == "" || filename == "." || filename == ".." {
+		filename = "dataset"
+	}
+	if ext != "" && !strings.HasSuffix(filename, "."+ext) {
+		filename += "." + ext
+	}
+	return
+}
+
+// Joins the relative path given by the server to the local directory.
+//
+// Returns an error if the resulting path is outside the directory.
+func safeJoin(dir, relpath string) (path string, err error) {
+	path = filepath.Join(dir, filepath.FromSlash(relpath))
+	if filepath.IsAbs(relpath) || (path != filepath.Clean(dir) && !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator))) {
+		err = errors.New("Invalid path given by the server: " + relpath)
+	}
+	return
+}
+
+// Downloads the dataset collection defined by its id (hdca id)
+// as a zip archive built by the server, and writes it to w.
+func (g *Galaxy) DownloadCollectionArchive(hdcaid string, w io.Writer) (err error) {
+	var url string = g.url + DATASET_COLLECTIONS + "/" + hdcaid + "/download"
+
+	err = g.galaxyGetRequestWriter(url, w)
+	return
+}
+
+// Downloads all the datasets of the dataset collection defined by its id (hdca id)
+// into the given local directory, element by element.
+//
+// Files are laid out by element identifiers: nested collections
+// (list:paired for example) are downloaded in sub directories, and
+// each dataset is named after its element identifier and extension
+// (<dir>/sample1/forward.fastqsanger for example).
+//
+// Returns a map with key: element identifiers joined by "/", value: local path
+// of the downloaded file.
+func (g *Galaxy) DownloadCollection(hdcaid, dir string) (paths map[string]string, err error) {
+	var collection DatasetCollection
+
+	if collection, err = g.GetCollection(hdcaid); err != nil {
+		return
+	}
+
+	paths = make(map[string]string)
+	err = g.downloadCollectionElements(collection.Elements, dir, "", paths)
+	return
+}
+
+// Recursively downloads the given collection elements in dir
+//
+// prefix is the identifier path of the parent collection.
+func (g *Galaxy) downloadCollectionElements(elements []CollectionElement, dir, prefix string, paths map[string]string) (err error) {
+	var identifier, path string
+
+	for _, e := range elements {
+		identifier = prefix + e.Element_identifier
+		if e.Element_type == "dataset_collection" {
+			if err = g.downloadCollectionElements(e.Object.Elements, filepath.Join(dir, datasetFileName(e.Element_identifier, "")), identifier+"/", paths); err != nil {
+				return
+			}
+			continue
+		}
+		path = filepath.Join(dir, datasetFileName(e.Element_identifier, e.Object.File_ext))
+		if err = g.downloadToFile(g.url+DATASETS+"/"+e.Object.Id+"/display", path); err != nil {
+			return
+		}
+		paths[identifier] = path
+	}
+	return
+}
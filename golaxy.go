@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net"
 	"net/http"
 	"os"
@@ -97,24 +96,14 @@ type HistoryShortInfo struct {
 	Url         string   `json:"url"`
 }
 
-// Request for fileupload
-type fileUpload struct {
-	File_type      string `json:"file_type"`
-	Dbkey          string `json:"dbkey"`
-	To_posix_lines bool   `json:"files0|to_posix_lines"`
-	Space_to_tab   bool   `json:"files0|space_to_tab"`
-	Filename       string `json:"files0|NAME"`
-	Type           string `json:"files0|type"`
-}
-
 // Response after calling a tool
 type toolResponse struct {
-	Outputs              []toolOutput `json:"outputs"`
-	Implicit_collections []string     `json:"implicit_collections"`
-	Jobs                 []toolJob    `json:"jobs"`
-	Output_collections   []string     `json:"output_collections"`
-	Err_msg              string       `json:"err_msg"`  // In case of error, this field is !=""
-	Err_code             int          `json:"err_code"` // In case of error, this field is !=0
+	Outputs              []toolOutput           `json:"outputs"`
+	Implicit_collections []toolOutputCollection `json:"implicit_collections"`
+	Jobs                 []toolJob              `json:"jobs"`
+	Output_collections   []toolOutputCollection `json:"output_collections"`
+	Err_msg              string                 `json:"err_msg"`  // In case of error, this field is !=""
+	Err_code             int                    `json:"err_code"` // In case of error, this field is !=0
 }
 
 type toolOutput struct {
@@ -145,6 +134,18 @@ type toolOutput struct {
 	Purged               bool     `json:"purged"`
 }
 
+// Dataset collection created by a tool
+type toolOutputCollection struct {
+	Id              string `json:"id"`
+	Hid             int    `json:"hid"`
+	Name            string `json:"name"`
+	Output_name     string `json:"output_name"`
+	Collection_type string `json:"collection_type"`
+	History_id      string `json:"history_id"`
+	Populated_state string `json:"populated_state"`
+	Model_class     string `json:"model_class"`
+}
+
 type toolJob struct {
 	Tool_id     string `json:"tool_id"`     // id of the tool
 	Update_time string `json:"update_time"` // time stamp
@@ -158,6 +159,8 @@ type toolJob struct {
 // Response when checking job status
 type job struct {
 	Tool_id      string               `json:"tool_id"`      // id of the tool
+	Tool_version string               `json:"tool_version"` // version of the tool
+	History_id   string               `json:"history_id"`   // id of the history of the job
 	Update_time  string               `json:"update_time"`  // timestamp
 	Inputs       map[string]toolInput `json:"inputs"`       // input datasets
 	Outputs      map[string]toolInput `json:"outputs"`      // output datasets
@@ -176,9 +179,10 @@ type job struct {
 
 // Request to call a tool
 type ToolLaunch struct {
-	History_id string                 `json:"history_id"` // Id of history
-	Tool_id    string                 `json:"tool_id"`    // Id of the tool
-	Inputs     map[string]interface{} `json:"inputs"`     // Inputs: key name of the input, value dataset id
+	History_id   string                 `json:"history_id"`             // Id of history
+	Tool_id      string                 `json:"tool_id"`                // Id of the tool
+	Tool_version string                 `json:"tool_version,omitempty"` // Version of the tool ("": default version)
+	Inputs       map[string]interface{} `json:"inputs"`                 // Inputs: key name of the input, value dataset id
 }
 
 type toolInput struct {
@@ -187,6 +191,20 @@ type toolInput struct {
 	UUid string `json:"uuid"` // ?
 }
 
+// Batch tool input: The tool is run once per value (map over)
+type toolBatchInput struct {
+	Batch  bool        `json:"batch"`  // always true
+	Values []toolInput `json:"values"` // datasets or collections to map over
+}
+
+// Result of a tool launch
+type ToolLaunchResult struct {
+	Outputs              map[string]string // Output datasets: map[out file name]=out file id
+	Output_collections   map[string]string // Output collections: map[tool output name]=collection id
+	Implicit_collections map[string]string // Collections created by mapping over inputs: map[tool output name]=collection id
+	Jobs                 []string          // Job ids (one per batch value when mapping over)
+}
+
 // Informations about a specific tool
 type ToolInfo struct {
 	Description          string             `json:"description"` // Description of the tool
@@ -215,9 +233,9 @@ type ToolShedRepository struct {
 }
 
 type WorkflowInput struct {
-	Label string `json:label`
-	Uuid  string `json:uuid`
-	Value string `json:uuid`
+	Label string `json:"label"`
+	Uuid  string `json:"uuid"`
+	Value string `json:"value"`
 }
 
 type WorkflowInputStep struct {
@@ -279,6 +297,24 @@ type WorkflowInvocation struct {
 	Err_Code    int                      `json:"err_code"`  // Err_Code=="" if no error
 }
 
+// Workflow invocation as returned by the invocations entry point,
+// with its labelled outputs
+type InvocationInfo struct {
+	Id                 string                   `json:"id"`
+	History_Id         string                   `json:"history_id"`
+	Workflow_Id        string                   `json:"workflow_id"`
+	State              string                   `json:"state"`
+	Inputs             map[string]toolInput     `json:"inputs"`
+	Outputs            map[string]toolInput     `json:"outputs"`            // key: output label, value: dataset
+	Output_collections map[string]toolInput     `json:"output_collections"` // key: output label, value: dataset collection (hdca)
+	Steps              []WorkflowInvocationStep `json:"steps"`
+	Update_Time        string                   `json:"update_time"`
+	Model_Class        string                   `json:"model_class"`
+	Traceboack         string                   `json:"traceback"` // Set only if the server returns an error
+	Err_Msg            string                   `json:"err_msg"`   // Err_Msg =="" if no error
+	Err_Code           int                      `json:"err_code"`  // Err_Code==0 if no error
+}
+
 // One of the steps given after invocation of the workflow
 type WorkflowInvocationStep struct {
 	Action              string `json:"action"`
@@ -318,11 +354,21 @@ type Galaxy struct {
 }
 
 const (
-	HISTORY   = "/api/histories"
-	CHECK_JOB = "/api/jobs/"
-	TOOLS     = "/api/tools"
-	WORKFLOWS = "/api/workflows"
-	VERSION   = "/api/version"
+	HISTORY             = "/api/histories"
+	CHECK_JOB           = "/api/jobs/"
+	TOOLS               = "/api/tools"
+	TOOLS_FETCH         = "/api/tools/fetch"
+	TUS_UPLOAD          = "/api/upload/resumable_upload/"
+	WORKFLOWS           = "/api/workflows"
+	INVOCATIONS         = "/api/invocations"
+	VERSION             = "/api/version"
+	DATASETS            = "/api/datasets"
+	DATASET_COLLECTIONS = "/api/dataset_collections"
+	FTP_FILES           = "/api/ftp_files"
+	TOOLSHED_REPOS      = "/api/tool_shed_repositories"
+	REPOSITORIES        = "/api/repositories" // Tool Shed entry point
+	TOOL_DATA           = "/api/tool_data"
+	GENOMES             = "/api/genomes"
 )
 
 // Initializes a new Galaxy with given:
@@ -438,138 +484,37 @@ func (g *Galaxy) DeleteHistory(historyid string) (state string, err error) {
 //
 // Returns the file id, the job id and a potential error
 func (g *Galaxy) UploadFile(historyid string, path string, ftype string) (fileid, jobid string, err error) {
-	var url string = g.url + TOOLS
+	fileid, jobid, err = g.UploadFileWithOptions(historyid, path, ftype, nil)
+	return
+}
+
+// Uploads the given file to the galaxy instance in the history defined by its id
+// and the given type (auto/txt/nhx/etc.), with the given options (dbkey, name,
+// tags, etc.).
+//
+// opts may be nil, default options are used in that case.
+//
+// Returns the file id, the job id (empty if the file was not uploaded because
+// of opts.Deduplicate) and a potential error
+func (g *Galaxy) UploadFileWithOptions(historyid string, path string, ftype string, opts *UploadOptions) (fileid, jobid string, err error) {
 	var file *os.File
-	var body2 []byte
-	var writer *multipart.Writer
-	var part io.Writer
-	var fileinput *fileUpload
-	var input []byte
-	var postrequest *http.Request
-	var postresponse *http.Response
-	var answer toolResponse
-	var r *io.PipeReader
-	var w *io.PipeWriter
-	var err2 error
-	var stat os.FileInfo
-	var fsize int64
-	var done chan error
 
 	if historyid == "" {
 		err = errors.New("UploadFile input history id is not valid")
 		return
 	}
 
-	if file, err = os.Open(path); err != nil {
-		return
-	}
-	if stat, err = file.Stat(); err != nil {
-		return
-	}
-	fsize = stat.Size()
-
-	fileinput = &fileUpload{
-		ftype,
-		"?",
-		false,
-		false,
-		filepath.Base(path),
-		"upload_dataset",
-	}
-	if input, err = json.Marshal(fileinput); err != nil {
-		err = errors.New("Error while marshaling fileinput: " + err.Error())
-		return
-	}
-	r, w = io.Pipe()
-	writer = multipart.NewWriter(w)
-
-	go func() {
-		done = make(chan error)
-		if postrequest, err2 = http.NewRequest("POST", url, r); err2 != nil {
-			err2 = errors.New("Error while creating new POST request: " + err2.Error())
-			done <- err2
-			return
-		}
-		postrequest.ContentLength = fsize                            // filesize
-		postrequest.ContentLength += int64(len(filepath.Base(path))) // Variable part of the content-length
-		postrequest.ContentLength += int64(len(string(input)))       // Variable part of the content-length
-		postrequest.ContentLength += int64(len(string(historyid)))   // Variable part of the content-length
-		postrequest.ContentLength += int64(602)                      // Constant part of the content-length
-		postrequest.Header.Set("Content-Type", writer.FormDataContentType())
-		postrequest.Header.Set("Transfer-Encoding", "chunked")
-		postrequest.Header.Set("x-api-key", g.apikey)
-		if postresponse, err2 = g.newClient().Do(postrequest); err2 != nil {
-			err2 = errors.New("Error while POSTing form: " + err2.Error())
-			done <- err2
-			return
-		}
-		done <- nil
-	}()
-
-	if part, err = writer.CreateFormFile("files_0|file_data", filepath.Base(path)); err != nil {
-		err = errors.New("Error while creating upload file form: " + err.Error())
-		return
-	}
-	if _, err = io.Copy(part, file); err != nil {
-		err = errors.New("Error while copying file content to form: " + err.Error())
-		return
-	}
-	if err = file.Close(); err != nil {
-		return
-	}
-
-	if err = writer.WriteField("history_id", historyid); err != nil {
-		err = errors.New("Error while writing history id to form: " + err.Error())
-		return
-	}
-
-	if err = writer.WriteField("tool_id", "upload1"); err != nil {
-		err = errors.New("Error while writing tool id to form: " + err.Error())
-		return
-	}
-
-	if err = writer.WriteField("inputs", string(input)); err != nil {
-		err = errors.New("Error while writing file inputs to form: " + err.Error())
-		return
-	}
-	if err = writer.Close(); err != nil {
-		return
-	}
-	if err = w.Close(); err != nil {
+	if opts != nil && opts.Deduplicate {
+		fileid, jobid, err = g.uploadFileDeduplicated(historyid, path, ftype, opts)
 		return
 	}
 
-	if err = <-done; err != nil {
-		return
-	}
-
-	if body2, err = ioutil.ReadAll(postresponse.Body); err != nil {
-		err = errors.New("Error while reading server respone: " + err.Error())
-		return
-	}
-	postresponse.Body.Close()
-
-	if err = json.Unmarshal(body2, &answer); err != nil {
-		err = errors.New("Error while unmarshaling server respone: " + err.Error())
-		return
-	}
-	if answer.Err_msg != "" {
-		err = errors.New(answer.Err_msg)
-		return
-	}
-
-	if len(answer.Outputs) != 1 {
-		err = errors.New("Error while uploading the file : Number of Outputs")
-		return
-	}
-
-	fileid = answer.Outputs[0].Id
-	if len(answer.Jobs) != 1 {
-		err = errors.New("Error while uploading the file : Number of Jobs")
+	if file, err = os.Open(path); err != nil {
 		return
 	}
-	jobid = answer.Jobs[0].Id
+	defer file.Close()
 
+	fileid, jobid, err = g.UploadReader(historyid, filepath.Base(path), file, ftype, opts)
 	return
 }
 
@@ -589,11 +534,20 @@ func (g *Galaxy) NewToolLauncher(historyid string, toolid string) (tl *ToolLaunc
 	tl = &ToolLaunch{
 		historyid,
 		toolid,
+		"",
 		make(map[string]interface{}),
 	}
 	return
 }
 
+// Pins the version of the tool to launch (see ListToolVersions).
+// By default, the default (latest) installed version is launched.
+//
+// LaunchTool fails if the given version is not installed.
+func (tl *ToolLaunch) SetToolVersion(version string) {
+	tl.Tool_version = version
+}
+
 // Add new input file to the Tool Launcher
 //
 //   - inputIndex : index of this input in the workflow (see WorkflowInfo / GetWorkflowById)
@@ -610,6 +564,36 @@ func (tl *ToolLaunch) AddParameter(paramname, paramvalue string) {
 	tl.Inputs[paramname] = paramvalue
 }
 
+// Add a dataset collection as input of the Tool launcher
+//   - paramname: name of the tool parameter (data_collection parameter)
+//   - hdcaid: id of the dataset collection
+func (tl *ToolLaunch) AddCollectionInput(paramname, hdcaid string) {
+	tl.Inputs[paramname] = toolInput{"hdca", hdcaid, ""}
+}
+
+// Add several datasets as batch input of the Tool launcher: The tool
+// is run once per dataset (one job per dataset), and the outputs are
+// gathered in implicit collections (see LaunchToolDetailed).
+//   - paramname: name of the tool parameter (data parameter)
+//   - fileids: ids of the datasets
+func (tl *ToolLaunch) AddBatchInput(paramname string, fileids ...string) {
+	var values []toolInput = make([]toolInput, 0, len(fileids))
+
+	for _, id := range fileids {
+		values = append(values, toolInput{"hda", id, ""})
+	}
+	tl.Inputs[paramname] = toolBatchInput{true, values}
+}
+
+// Add a dataset collection as batch input of the Tool launcher: The tool
+// is mapped over the elements of the collection (one job per element), and
+// the outputs are gathered in implicit collections (see LaunchToolDetailed).
+//   - paramname: name of the tool parameter (data parameter)
+//   - hdcaid: id of the dataset collection
+func (tl *ToolLaunch) AddBatchCollectionInput(paramname, hdcaid string) {
+	tl.Inputs[paramname] = toolBatchInput{true, []toolInput{{"hdca", hdcaid, ""}}}
+}
+
 // Launches a job at the given galaxy instance, with:
 //   - The tool given by its id (name)
 //   - Using the given history
@@ -618,10 +602,67 @@ func (tl *ToolLaunch) AddParameter(paramname, paramvalue string) {
 // Returns:
 //   - Tool outputs : map[out file name]=out file id
 //   - Jobs: array of job ids
+//
+// Output collections are not returned, see LaunchToolDetailed.
 func (g *Galaxy) LaunchTool(tl *ToolLaunch) (outfiles map[string]string, jobids []string, err error) {
+	var result *ToolLaunchResult
+
+	if result, err = g.LaunchToolDetailed(tl); err != nil {
+		return
+	}
+	outfiles = result.Outputs
+	jobids = result.Jobs
+	return
+}
+
+// Launches a job at the given galaxy instance, like LaunchTool.
+//
+// Returns, in addition to the output datasets and the jobs, the output
+// collections of the tool and the implicit collections created when the
+// tool is mapped over collections or batch inputs, both keyed by the name
+// of the tool output.
+func (g *Galaxy) LaunchToolDetailed(tl *ToolLaunch) (result *ToolLaunchResult, err error) {
+	var answer toolResponse
+
+	if answer, err = g.launchTool(tl); err != nil {
+		return
+	}
+
+	result = &ToolLaunchResult{
+		Outputs:              make(map[string]string),
+		Output_collections:   make(map[string]string),
+		Implicit_collections: make(map[string]string),
+		Jobs:                 make([]string, 0, 10),
+	}
+	for _, to := range answer.Outputs {
+		result.Outputs[to.Name] = to.Id
+	}
+	for _, c := range answer.Output_collections {
+		result.Output_collections[c.Output_name] = c.Id
+	}
+	for _, c := range answer.Implicit_collections {
+		result.Implicit_collections[c.Output_name] = c.Id
+	}
+	for _, j := range answer.Jobs {
+		result.Jobs = append(result.Jobs, j.Id)
+	}
+
+	return
+}
+
+// Launches a job at the given galaxy instance and returns the raw response.
+//
+// If the tool version is pinned, the launch fails if this version is not
+// installed: galaxy would silently run the default version otherwise.
+func (g *Galaxy) launchTool(tl *ToolLaunch) (answer toolResponse, err error) {
 	var url string = g.url + TOOLS
 	var input []byte
-	var answer toolResponse
+
+	if tl.Tool_version != "" {
+		if err = g.checkToolVersion(tl.Tool_id, tl.Tool_version); err != nil {
+			return
+		}
+	}
 
 	if input, err = json.Marshal(tl); err != nil {
 		return
@@ -633,18 +674,7 @@ func (g *Galaxy) LaunchTool(tl *ToolLaunch) (outfiles map[string]string, jobids
 
 	if answer.Err_msg != "" {
 		err = errors.New(answer.Err_msg)
-		return
-	}
-
-	outfiles = make(map[string]string)
-	for _, to := range answer.Outputs {
-		outfiles[to.Name] = to.Id
 	}
-	jobids = make([]string, 0, 10)
-	for _, j := range answer.Jobs {
-		jobids = append(jobids, j.Id)
-	}
-
 	return
 }
 
@@ -653,15 +683,9 @@ func (g *Galaxy) LaunchTool(tl *ToolLaunch) (outfiles map[string]string, jobids
 //   - job State
 //   - Output files: map : key: out filename value: out file id
 func (g *Galaxy) CheckJob(jobid string) (jobstate string, outfiles map[string]string, err error) {
-	var url string = g.url + CHECK_JOB + "/" + jobid
 	var answer job
 
-	if err = g.galaxyGetRequestJSON(url, &answer); err != nil {
-		return
-	}
-
-	if answer.Err_code != 0 || answer.Err_msg != "" {
-		err = errors.New(answer.Err_msg)
+	if answer, err = g.getJob(jobid); err != nil {
 		return
 	}
 
@@ -673,14 +697,34 @@ func (g *Galaxy) CheckJob(jobid string) (jobstate string, outfiles map[string]st
 	return
 }
 
+// Queries the galaxy instance to get all informations about the job defined by its Id
+func (g *Galaxy) getJob(jobid string) (answer job, err error) {
+	var url string = g.url + CHECK_JOB + "/" + jobid
+
+	if err = g.galaxyGetRequestJSON(url, &answer); err != nil {
+		return
+	}
+
+	if answer.Err_code != 0 || answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+	}
+	return
+}
+
 func (g *Galaxy) newClient() *http.Client {
+	return g.newClientWithTimeout(60 * time.Second)
+}
+
+// Returns a new http client whose requests time out after the given duration
+// (0: no timeout, connection and tls handshake still time out after 40s)
+func (g *Galaxy) newClientWithTimeout(timeout time.Duration) *http.Client {
 	config := &tls.Config{InsecureSkipVerify: g.trustcertificate}
 	tr := &http.Transport{
 		TLSClientConfig:     config,
 		Dial:                (&net.Dialer{Timeout: 40 * time.Second}).Dial,
 		TLSHandshakeTimeout: 40 * time.Second,
 	}
-	return &http.Client{Transport: tr, Timeout: 60 * time.Second}
+	return &http.Client{Transport: tr, Timeout: timeout}
 }
 
 // This function returns ID of the tools corresponding to
@@ -971,6 +1015,21 @@ func (g *Galaxy) CheckWorkflow(wfi *WorkflowInvocation) (wfstatus *WorkflowStatu
 	return
 }
 
+// Returns the workflow invocation defined by its id (see WorkflowInvocation.Id),
+// with its outputs and output collections keyed by their workflow labels
+func (g *Galaxy) GetInvocation(invocationid string) (invocation InvocationInfo, err error) {
+	var url string = g.url + INVOCATIONS + "/" + invocationid
+
+	if err = g.galaxyGetRequestJSON(url, &invocation); err != nil {
+		return
+	}
+
+	if invocation.Err_Code != 0 || invocation.Err_Msg != "" {
+		err = errors.New(invocation.Err_Msg)
+	}
+	return
+}
+
 // Cancels a running workflow.
 //
 // TODO: handle json response from the server in case of success... nothing described.
@@ -1130,6 +1189,82 @@ func (g *Galaxy) galaxyGetRequestJSON(url string, answer interface{}) (err error
 	return
 }
 
+// Requests the given url using GET,
+// and unmarshalls the expected resulting json list into the given
+// slice pointer.
+//
+// If the answer is not a list, then it is unmarshalled as a galaxy
+// error, and errmsg is returned if the server gives no message.
+func (g *Galaxy) galaxyGetRequestJSONList(url string, answer interface{}, errmsg string) (err error) {
+	var body []byte
+	var galaxyErr genericError
+
+	if body, err = g.galaxyGetRequestBytes(url); err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(body, answer); err != nil {
+		if err = json.Unmarshal(body, &galaxyErr); err != nil {
+			return
+		}
+		if galaxyErr.Err_Code != 0 || galaxyErr.Err_Msg != "" {
+			err = errors.New(galaxyErr.Err_Msg)
+		} else {
+			err = errors.New(errmsg)
+		}
+	}
+	return
+}
+
+// Requests the given url using GET,
+// and copies the response content to the given writer.
+//
+// Contrary to galaxyGetRequestBytes, the content is not loaded in memory,
+// and the response is checked: If the server does not answer 200, then
+// the error message given by galaxy is returned.
+func (g *Galaxy) galaxyGetRequestWriter(url string, w io.Writer) (err error) {
+	var req *http.Request
+	var response *http.Response
+	var client *http.Client
+	var body []byte
+	var galaxyErr genericError
+
+	if req, err = http.NewRequest("GET", url, nil); err != nil {
+		err = g.hideKeyFromError(err)
+		return
+	}
+	req.Header.Set("x-api-key", g.apikey)
+
+	for i := 0; i < g.requestattempts; i++ {
+		// No global timeout: Downloads of large files may last for hours
+		client = g.newClientWithTimeout(0)
+		if response, err = client.Do(req); err != nil {
+			err = g.hideKeyFromError(err)
+		} else {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		if body, err = ioutil.ReadAll(response.Body); err != nil {
+			return
+		}
+		if json.Unmarshal(body, &galaxyErr) == nil && galaxyErr.Err_Msg != "" {
+			err = errors.New(galaxyErr.Err_Msg)
+		} else {
+			err = errors.New(fmt.Sprintf("Error while downloading: %s (%s)", response.Status, string(body)))
+		}
+		return
+	}
+
+	_, err = io.Copy(w, response.Body)
+	return
+}
+
 // Send data to the given url using POST,
 // and unmarshalls the expected resulting json into the given structure.
 func (g *Galaxy) galaxyPostRequestJSON(url string, data []byte, answer interface{}) (err error) {
@@ -1143,6 +1278,7 @@ func (g *Galaxy) galaxyPostRequestJSON(url string, data []byte, answer interface
 		return
 	}
 	req.Header.Set("x-api-key", g.apikey)
+	req.Header.Set("Content-Type", "application/json")
 
 	for i := 0; i < g.requestattempts; i++ {
 		client = g.newClient()
@@ -1234,6 +1370,9 @@ func (g *Galaxy) galaxyDeleteRequestBytes(url string, data []byte) (answer []byt
 // This function replaces the api key in url that might be written
 // in the error message by XXXXXXXXXXXXXXXXXX
 func (g *Galaxy) hideKeyFromError(inerr error) (outerr error) {
+	if g.apikey == "" {
+		return inerr
+	}
 	newMessage := strings.Replace(inerr.Error(), g.apikey, "XXXXXXXXXXXXXXXXXX", -1)
 	outerr = errors.New(newMessage)
 	return
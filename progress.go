@@ -0,0 +1,125 @@
+package golaxy
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Minimum time between two calls to a progress callback
+const PROGRESS_INTERVAL = 500 * time.Millisecond
+
+// Progress of an upload, given to progress callbacks
+type UploadProgress struct {
+	Name  string        // Name of the file being uploaded
+	Sent  int64         // Number of bytes already sent
+	Total int64         // Total number of bytes to send (-1 if unknown)
+	Rate  float64       // Upload rate, in bytes per second
+	ETA   time.Duration // Estimated remaining time (-1 if unknown)
+}
+
+// Computes the progress of an upload and gives it to a callback
+type progressTracker struct {
+	progress UploadProgress
+	initial  int64     // Bytes already sent when the tracker was created (resumed uploads)
+	start    time.Time // Creation time of the tracker
+	last     time.Time // Time of the last call to the callback
+	reported int64     // Sent bytes given to the last call to the callback
+	callback func(UploadProgress)
+}
+
+// Reader that gives the number of bytes read to a progressTracker
+type progressReader struct {
+	reader  io.Reader
+	tracker *progressTracker
+}
+
+// Initializes a progress tracker for an upload of total bytes, of which
+// sent bytes are already sent.
+//
+// callback may be nil, nothing is reported in that case.
+func newProgressTracker(name string, sent, total int64, callback func(UploadProgress)) *progressTracker {
+	return &progressTracker{
+		progress: UploadProgress{name, sent, total, 0, -1},
+		initial:  sent,
+		start:    time.Now(),
+		callback: callback,
+	}
+}
+
+// Adds n bytes to the number of sent bytes
+func (p *progressTracker) add(n int64) {
+	p.set(p.progress.Sent + n)
+}
+
+// Sets the number of sent bytes, and calls the callback if the last call
+// is older than PROGRESS_INTERVAL, or if the upload is complete.
+func (p *progressTracker) set(sent int64) {
+	var now time.Time = time.Now()
+
+	p.progress.Sent = sent
+	if p.callback == nil || (!p.last.IsZero() && sent == p.reported) {
+		return
+	}
+	if now.Sub(p.last) < PROGRESS_INTERVAL && sent != p.progress.Total {
+		return
+	}
+	p.report(now)
+}
+
+// Calls the callback with the current progress, whatever the last call
+// time, if it has not already been given.
+func (p *progressTracker) finish() {
+	if p.callback != nil && (p.last.IsZero() || p.progress.Sent != p.reported) {
+		p.report(time.Now())
+	}
+}
+
+// Computes rate and ETA, and calls the callback
+func (p *progressTracker) report(now time.Time) {
+	var elapsed float64 = now.Sub(p.start).Seconds()
+
+	p.last = now
+	p.reported = p.progress.Sent
+	p.progress.Rate = 0
+	p.progress.ETA = -1
+	if elapsed > 0 {
+		p.progress.Rate = float64(p.progress.Sent-p.initial) / elapsed
+	}
+	if p.progress.Total >= 0 && p.progress.Rate > 0 {
+		p.progress.ETA = time.Duration(float64(p.progress.Total-p.progress.Sent) / p.progress.Rate * float64(time.Second))
+	}
+	p.callback(p.progress)
+}
+
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	r.tracker.add(int64(n))
+	return
+}
+
+// Returns the number of bytes that can be read from r if it can be known
+// without reading it (files, in memory readers), -1 otherwise.
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		// bytes.Reader, bytes.Buffer, strings.Reader
+		return int64(v.Len())
+	case interface {
+		io.Seeker
+		Stat() (os.FileInfo, error)
+	}:
+		// os.File, from its current position
+		var stat os.FileInfo
+		var cur int64
+		var err error
+		if stat, err = v.Stat(); err != nil || !stat.Mode().IsRegular() {
+			return -1
+		}
+		if cur, err = v.Seek(0, io.SeekCurrent); err != nil {
+			return -1
+		}
+		return stat.Size() - cur
+	}
+	return -1
+}
@@ -0,0 +1,224 @@
+package golaxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Provenance of a dataset: the job that produced it, with
+// its tool, parameters and input datasets.
+//
+// Input datasets are themselves DatasetProvenance. If the provenance
+// was not requested recursively, they only contain Dataset_id and Uuid.
+type DatasetProvenance struct {
+	Dataset_id   string                        `json:"dataset_id,omitempty"`   // id of the dataset
+	Uuid         string                        `json:"uuid,omitempty"`         // uuid of the dataset
+	Job_id       string                        `json:"job_id,omitempty"`       // id of the job that produced the dataset
+	Tool_id      string                        `json:"tool_id,omitempty"`      // id of the tool that produced the dataset
+	Tool_version string                        `json:"tool_version,omitempty"` // version of the tool that produced the dataset
+	Parameters   map[string]string             `json:"parameters,omitempty"`   // key: parameter name, value: json encoded parameter value
+	Inputs       map[string]*DatasetProvenance `json:"inputs,omitempty"`       // key: input name, value: provenance of the input dataset (nil if unknown)
+	Stdout       string                        `json:"stdout,omitempty"`
+	Stderr       string                        `json:"stderr,omitempty"`
+}
+
+// Response of /api/histories/<history id>/contents/<id>/provenance
+type provenanceRecord struct {
+	Id         string                     `json:"id"`         // id of the dataset
+	Uuid       string                     `json:"uuid"`       // uuid of the dataset
+	Job_id     string                     `json:"job_id"`     // id of the job
+	Tool_id    string                     `json:"tool_id"`    // id of the tool
+	Parameters map[string]json.RawMessage `json:"parameters"` // parameters (json strings) and input datasets (json objects)
+	Stdout     string                     `json:"stdout"`
+	Stderr     string                     `json:"stderr"`
+	Err_msg    string                     `json:"err_msg"`  // In case of error, this field is !=""
+	Err_code   int                        `json:"err_code"` // In case of error, this field is !=0
+}
+
+// Returns the provenance of the dataset defined by its id in the given history:
+// tool id, tool version, parameters and input datasets of the job that produced it.
+//
+// If recursive is true, the provenance of the input datasets is also
+// returned, up to the uploaded datasets.
+func (g *Galaxy) GetProvenance(historyid, datasetid string, recursive bool) (prov *DatasetProvenance, err error) {
+	var url string = g.url + HISTORY + "/" + historyid + "/contents/" + datasetid + "/provenance"
+	var answer provenanceRecord
+	var versions map[string]string
+
+	if recursive {
+		url += "?follow=true"
+	}
+
+	if err = g.galaxyGetRequestJSON(url, &answer); err != nil {
+		return
+	}
+
+	if answer.Err_code != 0 || answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+		return
+	}
+
+	if answer.Job_id == "" {
+		err = errors.New("No provenance information for dataset " + datasetid)
+		return
+	}
+
+	versions = make(map[string]string)
+	if prov, err = g.parseProvenanceRecord(&answer, versions); err != nil {
+		return
+	}
+	prov.Dataset_id = datasetid
+	return
+}
+
+// Converts a provenance record given by the server into a DatasetProvenance.
+//
+// Tool versions are not given by the provenance entry point, so they are
+// retrieved from the jobs, and cached in versions (key: job id, value: tool version).
+func (g *Galaxy) parseProvenanceRecord(record *provenanceRecord, versions map[string]string) (prov *DatasetProvenance, err error) {
+	var ok bool
+	var j job
+
+	prov = &DatasetProvenance{
+		Dataset_id: record.Id,
+		Uuid:       record.Uuid,
+		Job_id:     record.Job_id,
+		Tool_id:    record.Tool_id,
+		Parameters: make(map[string]string),
+		Inputs:     make(map[string]*DatasetProvenance),
+		Stdout:     record.Stdout,
+		Stderr:     record.Stderr,
+	}
+
+	if prov.Tool_version, ok = versions[record.Job_id]; !ok {
+		if j, err = g.getJob(record.Job_id); err != nil {
+			return
+		}
+		prov.Tool_version = j.Tool_version
+		versions[record.Job_id] = j.Tool_version
+	}
+
+	for name, raw := range record.Parameters {
+		var value string
+		var input provenanceRecord
+		trimmed := bytes.TrimSpace(raw)
+
+		switch {
+		case bytes.Equal(trimmed, []byte("null")):
+			// Input dataset without creating job
+			prov.Inputs[name] = nil
+		case len(trimmed) > 0 && trimmed[0] == '{':
+			if err = json.Unmarshal(trimmed, &input); err != nil {
+				return
+			}
+			if input.Job_id == "" {
+				// Non recursive: only the id and uuid of the input dataset
+				prov.Inputs[name] = &DatasetProvenance{Dataset_id: input.Id, Uuid: input.Uuid}
+			} else if prov.Inputs[name], err = g.parseProvenanceRecord(&input, versions); err != nil {
+				return
+			}
+		default:
+			if err = json.Unmarshal(trimmed, &value); err != nil {
+				// Not a string, we keep the raw json value
+				value = string(trimmed)
+				err = nil
+			}
+			prov.Parameters[name] = value
+		}
+	}
+	return
+}
+
+// Exports the lineage graph of the dataset in JSON format
+func (p *DatasetProvenance) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// Exports the lineage graph of the dataset in DOT format.
+//
+// Datasets are drawn as boxes and jobs as ellipses, labeled
+// with their tool id and version.
+func (p *DatasetProvenance) ToDOT() string {
+	var buffer bytes.Buffer
+	var nodes map[string]bool = make(map[string]bool)
+	var edges map[string]bool = make(map[string]bool)
+
+	buffer.WriteString("digraph provenance {\n")
+	p.writeDOT(&buffer, nodes, edges)
+	buffer.WriteString("}\n")
+	return buffer.String()
+}
+
+// Identifier of the dataset node in the DOT graph
+func (p *DatasetProvenance) dotDatasetNode() string {
+	if p.Dataset_id != "" {
+		return "dataset_" + p.Dataset_id
+	}
+	return "dataset_" + p.Uuid
+}
+
+// Writes the nodes and edges of this dataset and its inputs to the buffer.
+// Already written nodes and edges are not written again.
+func (p *DatasetProvenance) writeDOT(buffer *bytes.Buffer, nodes, edges map[string]bool) {
+	var datasetNode, jobNode, label string
+	var names []string
+
+	datasetNode = p.dotDatasetNode()
+	if !nodes[datasetNode] {
+		nodes[datasetNode] = true
+		label = p.Dataset_id
+		if label == "" {
+			label = p.Uuid
+		}
+		fmt.Fprintf(buffer, "\t%s [shape=box,label=%s];\n", strconv.Quote(datasetNode), strconv.Quote(label))
+	}
+
+	if p.Job_id == "" {
+		return
+	}
+
+	jobNode = "job_" + p.Job_id
+	if !nodes[jobNode] {
+		nodes[jobNode] = true
+		label = p.Tool_id
+		if p.Tool_version != "" {
+			label += "\n" + p.Tool_version
+		}
+		fmt.Fprintf(buffer, "\t%s [shape=ellipse,label=%s];\n", strconv.Quote(jobNode), strconv.Quote(label))
+	}
+	writeDOTEdge(buffer, edges, jobNode, datasetNode, "")
+
+	// Sorted for a reproducible output
+	names = make([]string, 0, len(p.Inputs))
+	for name := range p.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		input := p.Inputs[name]
+		if input == nil {
+			continue
+		}
+		input.writeDOT(buffer, nodes, edges)
+		writeDOTEdge(buffer, edges, input.dotDatasetNode(), jobNode, name)
+	}
+}
+
+func writeDOTEdge(buffer *bytes.Buffer, edges map[string]bool, from, to, label string) {
+	var key string = strings.Join([]string{from, to, label}, "\t")
+	if edges[key] {
+		return
+	}
+	edges[key] = true
+	if label == "" {
+		fmt.Fprintf(buffer, "\t%s -> %s;\n", strconv.Quote(from), strconv.Quote(to))
+	} else {
+		fmt.Fprintf(buffer, "\t%s -> %s [label=%s];\n", strconv.Quote(from), strconv.Quote(to), strconv.Quote(label))
+	}
+}
@@ -0,0 +1,130 @@
+package golaxy
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Launches again the job defined by its id, with the same tool, tool version,
+// history and parameters.
+//
+// If modify is not nil, it is called with the ToolLaunch before the launch,
+// to change some inputs or parameters.
+func (g *Galaxy) RerunJob(jobid string, modify func(*ToolLaunch)) (result *ToolLaunchResult, err error) {
+	return g.rerunJob(jobid, false, modify)
+}
+
+// Launches again the failed job defined by its id, like RerunJob, and
+// replaces its outputs by the outputs of the new job in the jobs depending
+// on it: Paused jobs waiting for the failed job (in a workflow for instance)
+// are resumed once the new job is done.
+func (g *Galaxy) RerunJobRemap(jobid string, modify func(*ToolLaunch)) (result *ToolLaunchResult, err error) {
+	return g.rerunJob(jobid, true, modify)
+}
+
+func (g *Galaxy) rerunJob(jobid string, remap bool, modify func(*ToolLaunch)) (result *ToolLaunchResult, err error) {
+	var j job
+	var build toolBuild
+	var tl *ToolLaunch
+
+	if j, err = g.getJob(jobid); err != nil {
+		return
+	}
+
+	if build, err = g.buildJobForRerun(jobid); err != nil {
+		return
+	}
+
+	tl = g.NewToolLauncher(j.History_id, j.Tool_id)
+	tl.SetToolVersion(j.Tool_version)
+	if tl.Tool_version == "" {
+		tl.SetToolVersion(build.Version)
+	}
+	if err = addToolStateInputs(tl, build.Inputs, ""); err != nil {
+		return
+	}
+	if remap {
+		tl.AddParameter("rerun_remap_job_id", jobid)
+	}
+
+	if modify != nil {
+		modify(tl)
+	}
+
+	result, err = g.LaunchToolDetailed(tl)
+	return
+}
+
+// Queries the galaxy instance for the tool form of the job defined by its
+// id, containing the parameter values of the job
+func (g *Galaxy) buildJobForRerun(jobid string) (build toolBuild, err error) {
+	var url string = g.url + CHECK_JOB + "/" + jobid + "/build_for_rerun"
+
+	if err = g.galaxyGetRequestJSON(url, &build); err != nil {
+		return
+	}
+	if build.Err_code != 0 || build.Err_msg != "" {
+		err = errors.New(build.Err_msg)
+	}
+	return
+}
+
+// Adds the values of the given parameters to the ToolLaunch inputs,
+// with their flat names (cond|param, repeat_0|param, section|param).
+func addToolStateInputs(tl *ToolLaunch, params []*ToolParameter, prefix string) (err error) {
+	for _, p := range params {
+		var name string = prefix + p.Name
+
+		switch p.Type {
+		case "section":
+			err = addToolStateInputs(tl, p.Inputs, name+"|")
+		case "repeat":
+			for i, instance := range p.Cache {
+				if err = addToolStateInputs(tl, instance, name+"_"+strconv.Itoa(i)+"|"); err != nil {
+					return
+				}
+			}
+		case "conditional":
+			if p.Test_param != nil {
+				err = addToolStateInputs(tl, p.activeCaseInputs(name+"|", tl.Inputs), name+"|")
+			}
+		case "data", "data_collection":
+			err = addDataStateInput(tl, name, p.Value)
+		default:
+			if p.Value != nil {
+				tl.AddTypedParameter(name, p.Value)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Adds the value of a data parameter, given as {"values": [{"src":..., "id":...}], "batch": ...},
+// to the ToolLaunch inputs
+func addDataStateInput(tl *ToolLaunch, name string, value interface{}) (err error) {
+	var content []byte
+	var state toolBatchInput
+
+	if value == nil {
+		return
+	}
+	if content, err = json.Marshal(value); err != nil {
+		return
+	}
+	if err = json.Unmarshal(content, &state); err != nil {
+		return
+	}
+
+	switch {
+	case len(state.Values) == 0:
+	case len(state.Values) == 1 && !state.Batch:
+		tl.Inputs[name] = state.Values[0]
+	default:
+		tl.Inputs[name] = state
+	}
+	return
+}
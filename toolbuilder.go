@@ -0,0 +1,114 @@
+package golaxy
+
+import (
+	"strconv"
+)
+
+// Group of nested parameters of a ToolLaunch: conditional, repeat instance
+// or section.
+//
+// Parameters added to a group are stored in the ToolLaunch inputs with the
+// flat names expected by galaxy (cond|param, repeat_0|param, section|param):
+//
+//	tl := g.NewToolLauncher(historyid, toolid)
+//	q := tl.Repeat("queries", 0)
+//	q.AddFileInput("input2", fileid, "hda")
+//	c := q.Conditional("cond")
+//	c.AddParameter("type", "advanced")
+//	c.AddTypedParameter("threshold", 0.05)
+type ToolParameterGroup struct {
+	launch *ToolLaunch
+	prefix string // Flat name of the group, followed by "|"
+}
+
+// Returns the conditional defined by its name, to add parameters in it
+// (the test parameter and the parameters of the selected case)
+func (tl *ToolLaunch) Conditional(name string) *ToolParameterGroup {
+	return tl.rootGroup().Conditional(name)
+}
+
+// Returns the section defined by its name, to add parameters in it
+func (tl *ToolLaunch) Section(name string) *ToolParameterGroup {
+	return tl.rootGroup().Section(name)
+}
+
+// Returns the instance of the repeat defined by its name and index
+// (starting at 0), to add parameters in it
+func (tl *ToolLaunch) Repeat(name string, index int) *ToolParameterGroup {
+	return tl.rootGroup().Repeat(name, index)
+}
+
+// Add new typed parameter to Tool launcher
+//   - paramname: name of the tool parameter
+//   - paramvalue: value of the given parameter (string, bool, int, float64, []string, etc.)
+func (tl *ToolLaunch) AddTypedParameter(paramname string, paramvalue interface{}) {
+	tl.Inputs[paramname] = paramvalue
+}
+
+// Add new multi-valued parameter to Tool launcher (select parameters
+// accepting several values for instance)
+//   - paramname: name of the tool parameter
+//   - paramvalues: values of the given parameter
+func (tl *ToolLaunch) AddParameterValues(paramname string, paramvalues ...string) {
+	tl.Inputs[paramname] = append([]string{}, paramvalues...)
+}
+
+func (tl *ToolLaunch) rootGroup() *ToolParameterGroup {
+	return &ToolParameterGroup{tl, ""}
+}
+
+// Returns the conditional defined by its name, nested in the group
+func (pg *ToolParameterGroup) Conditional(name string) *ToolParameterGroup {
+	return &ToolParameterGroup{pg.launch, pg.prefix + name + "|"}
+}
+
+// Returns the section defined by its name, nested in the group
+func (pg *ToolParameterGroup) Section(name string) *ToolParameterGroup {
+	return &ToolParameterGroup{pg.launch, pg.prefix + name + "|"}
+}
+
+// Returns the instance of the repeat defined by its name and index
+// (starting at 0), nested in the group
+func (pg *ToolParameterGroup) Repeat(name string, index int) *ToolParameterGroup {
+	return &ToolParameterGroup{pg.launch, pg.prefix + name + "_" + strconv.Itoa(index) + "|"}
+}
+
+// Returns the flat name of the given parameter of the group
+func (pg *ToolParameterGroup) ParameterName(paramname string) string {
+	return pg.prefix + paramname
+}
+
+// Add new parameter to the group (see ToolLaunch.AddParameter)
+func (pg *ToolParameterGroup) AddParameter(paramname, paramvalue string) {
+	pg.launch.AddParameter(pg.prefix+paramname, paramvalue)
+}
+
+// Add new typed parameter to the group (see ToolLaunch.AddTypedParameter)
+func (pg *ToolParameterGroup) AddTypedParameter(paramname string, paramvalue interface{}) {
+	pg.launch.AddTypedParameter(pg.prefix+paramname, paramvalue)
+}
+
+// Add new multi-valued parameter to the group (see ToolLaunch.AddParameterValues)
+func (pg *ToolParameterGroup) AddParameterValues(paramname string, paramvalues ...string) {
+	pg.launch.AddParameterValues(pg.prefix+paramname, paramvalues...)
+}
+
+// Add new input file to the group (see ToolLaunch.AddFileInput)
+func (pg *ToolParameterGroup) AddFileInput(paramname, fileid, filesrc string) {
+	pg.launch.AddFileInput(pg.prefix+paramname, fileid, filesrc)
+}
+
+// Add a dataset collection as input of the group (see ToolLaunch.AddCollectionInput)
+func (pg *ToolParameterGroup) AddCollectionInput(paramname, hdcaid string) {
+	pg.launch.AddCollectionInput(pg.prefix+paramname, hdcaid)
+}
+
+// Add several datasets as batch input of the group (see ToolLaunch.AddBatchInput)
+func (pg *ToolParameterGroup) AddBatchInput(paramname string, fileids ...string) {
+	pg.launch.AddBatchInput(pg.prefix+paramname, fileids...)
+}
+
+// Add a dataset collection as batch input of the group (see ToolLaunch.AddBatchCollectionInput)
+func (pg *ToolParameterGroup) AddBatchCollectionInput(paramname, hdcaid string) {
+	pg.launch.AddBatchCollectionInput(pg.prefix+paramname, hdcaid)
+}
@@ -0,0 +1,93 @@
+package golaxy
+
+import (
+	"errors"
+)
+
+// Tool data table of a galaxy instance, as returned by ListToolDataTables
+type ToolDataTableInfo struct {
+	Name        string `json:"name"`
+	Model_class string `json:"model_class"`
+}
+
+// Content of a tool data table (all_fasta, bwa_mem_indexes, fasta_indexes, etc.)
+type ToolDataTable struct {
+	Name        string     `json:"name"`
+	Model_class string     `json:"model_class"`
+	Columns     []string   `json:"columns"`  // Names of the columns (value, dbkey, name, path, etc.)
+	Fields      [][]string `json:"fields"`   // Rows of the table, in the order of the columns
+	Err_msg     string     `json:"err_msg"`  // In case of error, this field is !=""
+	Err_code    int        `json:"err_code"` // In case of error, this field is !=0
+}
+
+// Reference genome (dbkey) of a galaxy instance
+type Genome struct {
+	Name  string
+	Dbkey string
+}
+
+// Lists the tool data tables of the galaxy instance
+func (g *Galaxy) ListToolDataTables() (tables []ToolDataTableInfo, err error) {
+	err = g.galaxyGetRequestJSONList(g.url+TOOL_DATA, &tables, "Error while listing tool data tables")
+	return
+}
+
+// Returns the columns and rows of the tool data table defined by its name.
+//
+// The value column of a row is the value to give to the tool parameters
+// using the table (see ToolLaunch.AddParameter).
+func (g *Galaxy) GetToolDataTable(name string) (table ToolDataTable, err error) {
+	var url string = g.url + TOOL_DATA + "/" + name
+
+	if err = g.galaxyGetRequestJSON(url, &table); err != nil {
+		return
+	}
+	if table.Err_code != 0 || table.Err_msg != "" {
+		err = errors.New(table.Err_msg)
+	}
+	return
+}
+
+// Returns the rows of the table as maps: key: column name, value: field
+func (t *ToolDataTable) Rows() (rows []map[string]string) {
+	rows = make([]map[string]string, 0, len(t.Fields))
+	for _, f := range t.Fields {
+		var row map[string]string = make(map[string]string)
+		for i, c := range t.Columns {
+			if i < len(f) {
+				row[c] = f[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+// Returns the rows of the table having the given value in the given
+// column (for instance all rows with dbkey "hg38")
+func (t *ToolDataTable) FindRows(column, value string) (rows []map[string]string) {
+	for _, row := range t.Rows() {
+		if row[column] == value {
+			rows = append(rows, row)
+		}
+	}
+	return
+}
+
+// Lists the reference genomes (dbkeys) known by the galaxy instance
+func (g *Galaxy) ListGenomes() (genomes []Genome, err error) {
+	var answer [][]string
+
+	if err = g.galaxyGetRequestJSONList(g.url+GENOMES, &answer, "Error while listing genomes"); err != nil {
+		return
+	}
+
+	genomes = make([]Genome, 0, len(answer))
+	for _, a := range answer {
+		if len(a) < 2 {
+			continue
+		}
+		genomes = append(genomes, Genome{a[0], a[1]})
+	}
+	return
+}
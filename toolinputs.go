@@ -0,0 +1,491 @@
+package golaxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parameter of a tool, as described by the tool build entry point.
+//
+// Conditional, repeat and section parameters contain nested parameters.
+type ToolParameter struct {
+	Name             string                `json:"name"`
+	Label            string                `json:"label"`
+	Help             string                `json:"help"`
+	Type             string                `json:"type"` // data, data_collection, select, integer, float, boolean, text, hidden, conditional, repeat, section, etc.
+	Model_class      string                `json:"model_class"`
+	Optional         bool                  `json:"optional"`
+	Multiple         bool                  `json:"multiple"`         // select and data parameters accepting several values
+	Value            interface{}           `json:"value"`            // current value
+	Default_value    interface{}           `json:"default_value"`    // default value (recent galaxy versions only)
+	Extensions       []string              `json:"extensions"`       // data parameters: accepted formats
+	Collection_types []string              `json:"collection_types"` // data_collection parameters: accepted collection types
+	Options          []ToolParameterOption `json:"-"`                // select parameters: possible values
+	Min              *float64              `json:"-"`                // integer/float: lower bound, repeat: min number of instances (nil if none)
+	Max              *float64              `json:"-"`                // integer/float: upper bound, repeat: max number of instances (nil if none)
+	Test_param       *ToolParameter        `json:"test_param"`       // conditional: parameter selecting the case
+	Cases            []ToolParameterCase   `json:"cases"`            // conditional: parameters of each case
+	Inputs           []*ToolParameter      `json:"inputs"`           // repeat, section: nested parameters
+	Cache            [][]*ToolParameter    `json:"cache"`            // repeat: parameters of each instance, with their values
+}
+
+// Possible value of a select parameter
+type ToolParameterOption struct {
+	Label    string
+	Value    string
+	Selected bool
+}
+
+// Case of a conditional parameter
+type ToolParameterCase struct {
+	Value  string           `json:"value"`  // value of the test parameter selecting the case
+	Inputs []*ToolParameter `json:"inputs"` // parameters of the case
+}
+
+// Response of the tool build entry point
+type toolBuild struct {
+	Id       string           `json:"id"`
+	Name     string           `json:"name"`
+	Version  string           `json:"version"`
+	Versions []string         `json:"versions"` // All installed versions of the tool
+	Inputs   []*ToolParameter `json:"inputs"`
+	Err_msg  string           `json:"err_msg"`  // In case of error, this field is !=""
+	Err_code int              `json:"err_code"` // In case of error, this field is !=0
+}
+
+// Select options are given as [label, value, selected] arrays, data options
+// as lists of datasets, and bounds as numbers, strings or null.
+func (p *ToolParameter) UnmarshalJSON(data []byte) (err error) {
+	type parameter ToolParameter
+	var aux struct {
+		*parameter
+		Options json.RawMessage `json:"options"`
+		Min     json.RawMessage `json:"min"`
+		Max     json.RawMessage `json:"max"`
+	}
+	var options [][]interface{}
+
+	aux.parameter = (*parameter)(p)
+	if err = json.Unmarshal(data, &aux); err != nil {
+		return
+	}
+
+	p.Min = parseBound(aux.Min)
+	p.Max = parseBound(aux.Max)
+
+	// Data parameter options are not arrays, they are ignored
+	if json.Unmarshal(aux.Options, &options) == nil {
+		for _, o := range options {
+			var opt ToolParameterOption
+			if len(o) > 0 {
+				opt.Label = fmt.Sprint(o[0])
+			}
+			if len(o) > 1 {
+				opt.Value = fmt.Sprint(o[1])
+			}
+			if len(o) > 2 {
+				opt.Selected, _ = o[2].(bool)
+			}
+			p.Options = append(p.Options, opt)
+		}
+	}
+	return
+}
+
+// Parses a parameter bound, nil if not defined or not a number
+func parseBound(raw json.RawMessage) *float64 {
+	var v interface{}
+	var f float64
+	var err error
+
+	if json.Unmarshal(raw, &v) != nil {
+		return nil
+	}
+	switch val := v.(type) {
+	case float64:
+		f = val
+	case string:
+		if f, err = strconv.ParseFloat(val, 64); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &f
+}
+
+// Returns the parameters of the tool defined by its id, as they would be
+// displayed in the tool form of the given history (history may be "").
+func (g *Galaxy) GetToolInputs(toolid, historyid string) (inputs []*ToolParameter, err error) {
+	var build toolBuild
+
+	if build, err = g.buildTool(toolid, "", historyid); err != nil {
+		return
+	}
+	inputs = build.Inputs
+	return
+}
+
+// Returns the versions of the tool defined by its id that are installed
+// on the galaxy instance
+func (g *Galaxy) ListToolVersions(toolid string) (versions []string, err error) {
+	var build toolBuild
+
+	if build, err = g.buildTool(toolid, "", ""); err != nil {
+		return
+	}
+	versions = build.Versions
+	if len(versions) == 0 && build.Version != "" {
+		versions = []string{build.Version}
+	}
+	return
+}
+
+// Returns an error if the given version of the tool defined by its id
+// is not installed on the galaxy instance
+func (g *Galaxy) checkToolVersion(toolid, version string) (err error) {
+	var versions []string
+
+	if versions, err = g.ListToolVersions(toolid); err != nil {
+		return
+	}
+	for _, v := range versions {
+		if v == version {
+			return
+		}
+	}
+	err = errors.New("Version " + version + " of tool " + toolid + " is not installed (installed: " + strings.Join(versions, ", ") + ")")
+	return
+}
+
+// Queries the tool build entry point for the tool defined by its id,
+// in the given version ("": default version) and history ("": no history)
+func (g *Galaxy) buildTool(toolid, version, historyid string) (build toolBuild, err error) {
+	var url string = g.url + TOOLS + "/" + toolid + "/build"
+	var params neturl.Values = neturl.Values{}
+
+	if version != "" {
+		params.Set("tool_version", version)
+	}
+	if historyid != "" {
+		params.Set("history_id", historyid)
+	}
+	if len(params) > 0 {
+		url += "?" + params.Encode()
+	}
+	if err = g.galaxyGetRequestJSON(url, &build); err != nil {
+		return
+	}
+	if build.Err_code != 0 || build.Err_msg != "" {
+		err = errors.New(build.Err_msg)
+	}
+	return
+}
+
+// Checks the inputs of the ToolLaunch against the parameters of the tool
+// (see GetToolInputs), before launching it:
+//   - Every input name must designate a tool parameter (cond|param, repeat_0|param
+//     and section|param for nested parameters)
+//   - Values must be compatible with the parameter type (datasets for data
+//     parameters, numbers within bounds, possible values of select parameters, etc.)
+//   - Required data parameters must be given, including in sections, in the
+//     active case of conditionals and in the instances of repeats
+//
+// Returns an error describing all the problems found, nil if none.
+func (g *Galaxy) ValidateToolLaunch(tl *ToolLaunch) (err error) {
+	var build toolBuild
+	var params []*ToolParameter
+	var problems []string
+	var names []string
+
+	if build, err = g.buildTool(tl.Tool_id, tl.Tool_version, tl.History_id); err != nil {
+		return
+	}
+	params = build.Inputs
+
+	names = make([]string, 0, len(tl.Inputs))
+	for name := range tl.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var p *ToolParameter
+		var perr error
+		if p, perr = lookupToolParameter(params, name, tl.Inputs); perr != nil {
+			problems = append(problems, perr.Error())
+			continue
+		}
+		if perr = checkToolParameterValue(p, tl.Inputs[name]); perr != nil {
+			problems = append(problems, name+": "+perr.Error())
+		}
+	}
+
+	problems = append(problems, missingToolParameters(params, "", tl.Inputs)...)
+
+	if len(problems) > 0 {
+		err = errors.New("Invalid inputs for tool " + tl.Tool_id + ": " + strings.Join(problems, "; "))
+	}
+	return
+}
+
+// Finds the parameter designated by the given flat name (cond|param,
+// repeat_0|param, section|param) in params.
+//
+// inputs are used to select the active case of conditionals.
+func lookupToolParameter(params []*ToolParameter, name string, inputs map[string]interface{}) (p *ToolParameter, err error) {
+	var parts []string = strings.Split(name, "|")
+	var prefix string
+
+	for i, part := range parts {
+		var last bool = (i == len(parts)-1)
+
+		if p = findToolParameter(params, part); p == nil {
+			// Repeat instance: name_index
+			if idx := strings.LastIndex(part, "_"); idx > 0 {
+				if _, e := strconv.Atoi(part[idx+1:]); e == nil {
+					if r := findToolParameter(params, part[:idx]); r != nil && r.Type == "repeat" {
+						if last {
+							err = errors.New("Repeat instance " + prefix + part + " is not a parameter")
+							return
+						}
+						params = r.Inputs
+						prefix += part + "|"
+						continue
+					}
+				}
+			}
+			err = errors.New("Unknown parameter " + prefix + part)
+			return
+		}
+
+		if last {
+			if p.Type == "conditional" || p.Type == "repeat" || p.Type == "section" {
+				err = errors.New(prefix + part + " is a " + p.Type + ", not a parameter")
+			}
+			return
+		}
+
+		switch p.Type {
+		case "section":
+			params = p.Inputs
+		case "conditional":
+			params = p.activeCaseInputs(prefix+part+"|", inputs)
+		case "repeat":
+			err = errors.New("Repeat " + prefix + part + " must be indexed (" + prefix + part + "_0)")
+			return
+		default:
+			err = errors.New(prefix + part + " has no nested parameters")
+			return
+		}
+		prefix += part + "|"
+	}
+	return
+}
+
+// Returns the parameter having the given name, nil if none
+func findToolParameter(params []*ToolParameter, name string) *ToolParameter {
+	for _, p := range params {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Returns the test parameter and the parameters of the case selected by
+// the value of the test parameter (given in inputs or its default value).
+// If no case matches, parameters of all cases are returned.
+func (p *ToolParameter) activeCaseInputs(prefix string, inputs map[string]interface{}) (params []*ToolParameter) {
+	var c *ToolParameterCase
+
+	if p.Test_param == nil {
+		return
+	}
+	params = []*ToolParameter{p.Test_param}
+
+	if c = p.activeCase(prefix, inputs); c != nil {
+		return append(params, c.Inputs...)
+	}
+	for _, c := range p.Cases {
+		params = append(params, c.Inputs...)
+	}
+	return
+}
+
+// Returns the case of the conditional selected by the value of its test
+// parameter (given in inputs or its default value), nil if none matches
+func (p *ToolParameter) activeCase(prefix string, inputs map[string]interface{}) *ToolParameterCase {
+	var value interface{}
+	var ok bool
+
+	if p.Test_param == nil {
+		return nil
+	}
+	if value, ok = inputs[prefix+p.Test_param.Name]; !ok {
+		value = p.Test_param.Value
+	}
+	for i, c := range p.Cases {
+		if value != nil && c.Value == fmt.Sprint(value) {
+			return &p.Cases[i]
+		}
+	}
+	return nil
+}
+
+// Returns the number of instances of the repeat parameter given in inputs
+// (highest index + 1), or its minimum number of instances if greater
+func (p *ToolParameter) repeatInstances(prefix string, inputs map[string]interface{}) (n int) {
+	if p.Min != nil {
+		n = int(*p.Min)
+	}
+	for name := range inputs {
+		var rest string
+		var idx int
+		var err error
+		if !strings.HasPrefix(name, prefix+p.Name+"_") {
+			continue
+		}
+		rest = strings.TrimPrefix(name, prefix+p.Name+"_")
+		if i := strings.Index(rest, "|"); i > 0 {
+			if idx, err = strconv.Atoi(rest[:i]); err == nil && idx >= n {
+				n = idx + 1
+			}
+		}
+	}
+	return
+}
+
+// Checks that the value is compatible with the type of the parameter
+func checkToolParameterValue(p *ToolParameter, value interface{}) (err error) {
+	var values []string
+
+	switch p.Type {
+	case "data", "data_collection":
+		switch v := value.(type) {
+		case toolInput:
+			if p.Type == "data_collection" && v.Src != "hdca" {
+				err = errors.New("expects a dataset collection")
+			}
+		case toolBatchInput:
+		default:
+			err = errors.New("expects a dataset")
+		}
+		return
+	case "integer", "float":
+		values = toolParameterValues(value, false)
+		for _, v := range values {
+			var f float64
+			if v == "" && p.Optional {
+				continue
+			}
+			if p.Type == "integer" {
+				var i int64
+				if i, err = strconv.ParseInt(v, 10, 64); err != nil {
+					return errors.New("expects an integer, got " + v)
+				}
+				f = float64(i)
+			} else if f, err = strconv.ParseFloat(v, 64); err != nil {
+				return errors.New("expects a number, got " + v)
+			}
+			if (p.Min != nil && f < *p.Min) || (p.Max != nil && f > *p.Max) {
+				return errors.New("value " + v + " out of bounds" + p.boundsString())
+			}
+		}
+	case "boolean":
+		for _, v := range toolParameterValues(value, false) {
+			if v = strings.ToLower(v); v != "true" && v != "false" {
+				return errors.New("expects a boolean, got " + v)
+			}
+		}
+	case "select", "genomebuild":
+		if len(p.Options) == 0 {
+			return
+		}
+		values = toolParameterValues(value, p.Multiple)
+		if len(values) > 1 && !p.Multiple {
+			return errors.New("does not accept several values")
+		}
+		for _, v := range values {
+			if v == "" && p.Optional {
+				continue
+			}
+			if !p.hasOption(v) {
+				return errors.New("unknown option " + v)
+			}
+		}
+	}
+	return
+}
+
+// Returns the given value as a list of strings. If split is true,
+// comma separated values are split.
+func toolParameterValues(value interface{}, split bool) (values []string) {
+	switch v := value.(type) {
+	case string:
+		if split {
+			return strings.Split(v, ",")
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		for _, e := range v {
+			values = append(values, fmt.Sprint(e))
+		}
+		return
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// Returns true if the select parameter has the given possible value
+func (p *ToolParameter) hasOption(value string) bool {
+	for _, o := range p.Options {
+		if o.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a description of the bounds of the parameter
+func (p *ToolParameter) boundsString() (bounds string) {
+	if p.Min != nil {
+		bounds += fmt.Sprintf(" min=%v", *p.Min)
+	}
+	if p.Max != nil {
+		bounds += fmt.Sprintf(" max=%v", *p.Max)
+	}
+	return
+}
+
+// Returns the required data parameters that are not given in inputs, at the
+// top level, in sections, in the active case of conditionals (none if no
+// case is selected), and in the instances of repeats (given in inputs, or
+// the minimum number of instances).
+func missingToolParameters(params []*ToolParameter, prefix string, inputs map[string]interface{}) (problems []string) {
+	for _, p := range params {
+		switch p.Type {
+		case "section":
+			problems = append(problems, missingToolParameters(p.Inputs, prefix+p.Name+"|", inputs)...)
+		case "conditional":
+			if c := p.activeCase(prefix+p.Name+"|", inputs); c != nil {
+				problems = append(problems, missingToolParameters(c.Inputs, prefix+p.Name+"|", inputs)...)
+			}
+		case "repeat":
+			for i := 0; i < p.repeatInstances(prefix, inputs); i++ {
+				problems = append(problems, missingToolParameters(p.Inputs, prefix+p.Name+"_"+strconv.Itoa(i)+"|", inputs)...)
+			}
+		case "data", "data_collection":
+			if _, ok := inputs[prefix+p.Name]; !ok && !p.Optional {
+				problems = append(problems, "Missing required input "+prefix+p.Name)
+			}
+		}
+	}
+	return
+}
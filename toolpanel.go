@@ -0,0 +1,71 @@
+package golaxy
+
+// Options of ListTools
+type ToolListOptions struct {
+	// If true, only tools are returned, without sections and labels
+	// (each tool gives its panel section in Panel_section_id/Panel_section_name)
+	Flatten bool
+}
+
+// Element of the tool panel: section, label or tool
+type ToolPanelElement struct {
+	Model_class        string             `json:"model_class"` // "ToolSection", "ToolSectionLabel" or "Tool"
+	Id                 string             `json:"id"`
+	Name               string             `json:"name"`
+	Text               string             `json:"text"` // Text of labels
+	Version            string             `json:"version"`
+	Description        string             `json:"description"`
+	Edam_operations    []string           `json:"edam_operations"`
+	Edam_topics        []string           `json:"edam_topics"`
+	Labels             []string           `json:"labels"`
+	Panel_section_id   string             `json:"panel_section_id"`
+	Panel_section_name string             `json:"panel_section_name"`
+	Tool_shed          ToolShedRepository `json:"tool_shed_repository"` // Tools installed from a toolshed
+	Elems              []ToolPanelElement `json:"elems"`                // Elements of sections
+}
+
+// Lists the tools available on the galaxy instance, as displayed in
+// the tool panel: Sections (containing labels and tools), and labels
+// and tools that are not in any section.
+//
+// If opts.Flatten is true, only the tools are returned.
+//
+// opts may be nil, default options are used in that case.
+func (g *Galaxy) ListTools(opts *ToolListOptions) (elements []ToolPanelElement, err error) {
+	var url string = g.url + TOOLS + "?in_panel=true"
+
+	if opts != nil && opts.Flatten {
+		url = g.url + TOOLS + "?in_panel=false"
+	}
+
+	err = g.galaxyGetRequestJSONList(url, &elements, "Error while listing tools")
+	return
+}
+
+// Returns true if the element is a section of the tool panel
+func (e ToolPanelElement) IsSection() bool {
+	return e.Model_class == "ToolSection"
+}
+
+// Returns true if the element is a label of the tool panel
+func (e ToolPanelElement) IsLabel() bool {
+	return e.Model_class == "ToolSectionLabel"
+}
+
+// Returns true if the element is a tool
+func (e ToolPanelElement) IsTool() bool {
+	return !e.IsSection() && !e.IsLabel()
+}
+
+// Returns all the tools of the given panel elements, including the tools
+// of sections, in panel order
+func FlattenToolPanel(elements []ToolPanelElement) (tools []ToolPanelElement) {
+	for _, e := range elements {
+		if e.IsSection() {
+			tools = append(tools, FlattenToolPanel(e.Elems)...)
+		} else if e.IsTool() {
+			tools = append(tools, e)
+		}
+	}
+	return
+}
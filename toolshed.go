@@ -0,0 +1,289 @@
+package golaxy
+
+import (
+	"encoding/json"
+	"errors"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status of repositories installed on a galaxy instance
+const (
+	REPOSITORY_INSTALLED   = "Installed"
+	REPOSITORY_ERROR       = "Error"
+	REPOSITORY_UNINSTALLED = "Uninstalled"
+	REPOSITORY_DEACTIVATED = "Deactivated"
+)
+
+// Time between two status queries of WaitRepositoryInstallation
+const REPOSITORY_POLL_INTERVAL = 5 * time.Second
+
+// Client of a Tool Shed (https://toolshed.g2.bx.psu.edu for instance)
+type ToolShed struct {
+	client *Galaxy // Tool Shed requests are sent like galaxy requests, without api key
+}
+
+// Repository of a Tool Shed, as returned by SearchRepositories
+type ToolShedRepositoryInfo struct {
+	Id                    string   `json:"id"`
+	Name                  string   `json:"name"`
+	Repo_owner_username   string   `json:"repo_owner_username"`
+	Description           string   `json:"description"`
+	Long_description      string   `json:"long_description"`
+	Homepage_url          string   `json:"homepage_url"`
+	Remote_repository_url string   `json:"remote_repository_url"`
+	Full_last_updated     string   `json:"full_last_updated"`
+	Categories            []string `json:"categories"`
+	Times_downloaded      int      `json:"times_downloaded"`
+}
+
+// Options of InstallRepository
+type ToolShedInstallOptions struct {
+	Install_tool_dependencies       bool   // Installs tool dependencies defined in the Tool Shed (legacy)
+	Install_repository_dependencies bool   // Installs the repositories the repository depends on
+	Install_resolver_dependencies   bool   // Installs tool requirements with dependency resolvers (conda)
+	Tool_panel_section_id           string // Existing tool panel section in which tools are added
+	New_tool_panel_section_label    string // New tool panel section in which tools are added
+}
+
+// Repository installed on a galaxy instance
+type InstalledRepository struct {
+	ToolShedRepository
+	Id                           string `json:"id"`
+	Installed_changeset_revision string `json:"installed_changeset_revision"`
+	Ctx_rev                      string `json:"ctx_rev"`
+	Status                       string `json:"status"` // See REPOSITORY_* constants
+	Error_message                string `json:"error_message"`
+	Deleted                      bool   `json:"deleted"`
+	Uninstalled                  bool   `json:"uninstalled"`
+	Model_class                  string `json:"model_class"`
+	Err_msg                      string `json:"err_msg"`  // In case of error, this field is !=""
+	Err_code                     int    `json:"err_code"` // In case of error, this field is !=0
+}
+
+type toolShedInstallRequest struct {
+	Tool_shed_url                   string `json:"tool_shed_url"`
+	Name                            string `json:"name"`
+	Owner                           string `json:"owner"`
+	Changeset_revision              string `json:"changeset_revision"`
+	Install_tool_dependencies       bool   `json:"install_tool_dependencies"`
+	Install_repository_dependencies bool   `json:"install_repository_dependencies"`
+	Install_resolver_dependencies   bool   `json:"install_resolver_dependencies"`
+	Tool_panel_section_id           string `json:"tool_panel_section_id,omitempty"`
+	New_tool_panel_section_label    string `json:"new_tool_panel_section_label,omitempty"`
+}
+
+// Message returned by galaxy when nothing is installed or uninstalled
+type toolShedMessage struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Err_msg  string `json:"err_msg"`
+	Err_code int    `json:"err_code"`
+}
+
+// Initializes a new Tool Shed client with given url of the form http(s)://ip:port
+func NewToolShed(url string, trustcertificate bool) *ToolShed {
+	return &ToolShed{NewGalaxy(url, "", trustcertificate)}
+}
+
+// Sets the number of times requests are tried if an error occurs
+// (see Galaxy.SetNbRequestAttempts)
+func (ts *ToolShed) SetNbRequestAttempts(attempts int) {
+	ts.client.SetNbRequestAttempts(attempts)
+}
+
+// Searches the Tool Shed repositories matching the given query.
+//
+// page starts at 1, and pagesize is the number of repositories per page.
+func (ts *ToolShed) SearchRepositories(query string, page, pagesize int) (repos []ToolShedRepositoryInfo, err error) {
+	var params neturl.Values = neturl.Values{}
+	var answer struct {
+		Hits []struct {
+			Repository ToolShedRepositoryInfo `json:"repository"`
+		} `json:"hits"`
+		Err_msg  string `json:"err_msg"`
+		Err_code int    `json:"err_code"`
+	}
+
+	params.Set("q", query)
+	params.Set("page", strconv.Itoa(page))
+	params.Set("page_size", strconv.Itoa(pagesize))
+
+	if err = ts.client.galaxyGetRequestJSON(ts.client.url+REPOSITORIES+"?"+params.Encode(), &answer); err != nil {
+		return
+	}
+	if answer.Err_code != 0 || answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+		return
+	}
+
+	repos = make([]ToolShedRepositoryInfo, 0, len(answer.Hits))
+	for _, h := range answer.Hits {
+		repos = append(repos, h.Repository)
+	}
+	return
+}
+
+// Lists the installable revisions (changeset revisions) of the repository
+// defined by its name and owner, from the oldest to the newest
+func (ts *ToolShed) ListRevisions(name, owner string) (revisions []string, err error) {
+	var params neturl.Values = neturl.Values{}
+
+	params.Set("name", name)
+	params.Set("owner", owner)
+
+	err = ts.client.galaxyGetRequestJSONList(ts.client.url+REPOSITORIES+"/get_ordered_installable_revisions?"+params.Encode(), &revisions,
+		"Error while listing revisions of repository "+owner+"/"+name)
+	return
+}
+
+// Returns the given repository at its newest installable revision
+func (ts *ToolShed) LatestRevision(name, owner string) (repo ToolShedRepository, err error) {
+	var revisions []string
+
+	if revisions, err = ts.ListRevisions(name, owner); err != nil {
+		return
+	}
+	if len(revisions) == 0 {
+		err = errors.New("No installable revision for repository " + owner + "/" + name)
+		return
+	}
+
+	repo = ToolShedRepository{
+		Changeset_Revision: revisions[len(revisions)-1],
+		Name:               name,
+		Owner:              owner,
+		Tool_shed:          strings.TrimSuffix(ts.client.url, "/"),
+	}
+	return
+}
+
+// Installs the given Tool Shed repository revision on the galaxy instance
+// (requires an admin api key). If repo.Tool_shed has no scheme, https is used.
+//
+// Installation is asynchronous: Its progress is given by the Status of the
+// repositories (see GetInstalledRepository and WaitRepositoryInstallation).
+//
+// opts may be nil, default options are used in that case (no dependency installed).
+//
+// Returns the installed repositories (the repository and its repository
+// dependencies). It is empty if the repository was already installed.
+func (g *Galaxy) InstallRepository(repo ToolShedRepository, opts *ToolShedInstallOptions) (repos []InstalledRepository, err error) {
+	var url string = g.url + TOOLSHED_REPOS
+	var request toolShedInstallRequest
+	var input []byte
+	var answer json.RawMessage
+	var message toolShedMessage
+
+	request = toolShedInstallRequest{
+		Tool_shed_url:      toolShedURL(repo.Tool_shed),
+		Name:               repo.Name,
+		Owner:              repo.Owner,
+		Changeset_revision: repo.Changeset_Revision,
+	}
+	if opts != nil {
+		request.Install_tool_dependencies = opts.Install_tool_dependencies
+		request.Install_repository_dependencies = opts.Install_repository_dependencies
+		request.Install_resolver_dependencies = opts.Install_resolver_dependencies
+		request.Tool_panel_section_id = opts.Tool_panel_section_id
+		request.New_tool_panel_section_label = opts.New_tool_panel_section_label
+	}
+
+	if input, err = json.Marshal(request); err != nil {
+		return
+	}
+
+	if err = g.galaxyPostRequestJSON(url, input, &answer); err != nil {
+		return
+	}
+
+	// A list of repositories if something is installed, a message otherwise
+	if json.Unmarshal(answer, &repos) == nil {
+		return
+	}
+	if err = json.Unmarshal(answer, &message); err != nil {
+		return
+	}
+	if message.Err_code != 0 || message.Err_msg != "" {
+		err = errors.New(message.Err_msg)
+	} else if message.Status == "error" {
+		err = errors.New(message.Message)
+	}
+	return
+}
+
+// Returns the repository installed on the galaxy instance, defined by its id,
+// with its installation status
+func (g *Galaxy) GetInstalledRepository(repoid string) (repo InstalledRepository, err error) {
+	var url string = g.url + TOOLSHED_REPOS + "/" + repoid
+
+	if err = g.galaxyGetRequestJSON(url, &repo); err != nil {
+		return
+	}
+	if repo.Err_code != 0 || repo.Err_msg != "" {
+		err = errors.New(repo.Err_msg)
+	}
+	return
+}
+
+// Waits for the installation of the repository defined by its id to be
+// finished, by querying its status every REPOSITORY_POLL_INTERVAL.
+//
+// Returns the repository once its status is REPOSITORY_INSTALLED, or an error
+// if its status is REPOSITORY_ERROR or if it is not installed after timeout
+// (0: no timeout).
+func (g *Galaxy) WaitRepositoryInstallation(repoid string, timeout time.Duration) (repo InstalledRepository, err error) {
+	var start time.Time = time.Now()
+
+	for {
+		if repo, err = g.GetInstalledRepository(repoid); err != nil {
+			return
+		}
+		switch repo.Status {
+		case REPOSITORY_INSTALLED:
+			return
+		case REPOSITORY_ERROR:
+			err = errors.New("Installation of repository " + repo.Owner + "/" + repo.Name + " failed: " + repo.Error_message)
+			return
+		}
+		if timeout > 0 && time.Since(start) > timeout {
+			err = errors.New("Repository " + repo.Owner + "/" + repo.Name + " not installed after " + timeout.String() + " (status: " + repo.Status + ")")
+			return
+		}
+		time.Sleep(REPOSITORY_POLL_INTERVAL)
+	}
+}
+
+// Lists the repositories installed on the galaxy instance
+func (g *Galaxy) ListInstalledRepositories() (repos []InstalledRepository, err error) {
+	err = g.galaxyGetRequestJSONList(g.url+TOOLSHED_REPOS, &repos, "Error while listing installed repositories")
+	return
+}
+
+// Uninstalls the repository defined by its id from the galaxy instance
+// (requires an admin api key). If removefromdisk is false, the repository
+// is only deactivated.
+func (g *Galaxy) UninstallRepository(repoid string, removefromdisk bool) (err error) {
+	var url string = g.url + TOOLSHED_REPOS + "/" + repoid + "?remove_from_disk=" + strconv.FormatBool(removefromdisk)
+	var answer toolShedMessage
+
+	if err = g.galaxyDeleteRequestJSON(url, nil, &answer); err != nil {
+		return
+	}
+	if answer.Err_code != 0 || answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+	} else if answer.Status == "error" {
+		err = errors.New(answer.Message)
+	}
+	return
+}
+
+// Returns the url of the given tool shed, adding https:// if it has no scheme
+func toolShedURL(toolshed string) string {
+	if strings.HasPrefix(toolshed, "http://") || strings.HasPrefix(toolshed, "https://") {
+		return toolshed
+	}
+	return "https://" + toolshed
+}
@@ -0,0 +1,597 @@
+package golaxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	neturl "net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TOOL_TEST_POLL_INTERVAL   = 5 * time.Second
+	DEFAULT_TOOL_TEST_TIMEOUT = 3600  // in seconds, if the test gives no maxseconds
+	DEFAULT_SIM_SIZE_DELTA    = 10000 // in bytes, if a sim_size test gives no delta
+)
+
+// Comparison modes and assertions of test outputs that are checked. Other
+// checks are reported as warnings of the test.
+var toolTestComparisons = map[string]bool{"": true, "diff": true, "contains": true, "sim_size": true}
+var toolTestAssertions = map[string]bool{"has_text": true, "not_has_text": true, "has_line": true}
+
+// Report of the functional tests of a tool (see RunToolTests)
+type ToolTestReport struct {
+	Tool_id      string
+	Tool_version string
+	History_id   string // History in which the tests were run
+	Passed       int    // Number of passed tests
+	Failed       int    // Number of failed tests
+	Tests        []ToolTestResult
+}
+
+// Result of a test case of a tool
+type ToolTestResult struct {
+	Index    int
+	Name     string
+	Job_id   string
+	Passed   bool
+	Errors   []string // Reasons of the failure
+	Warnings []string // Checks of the test that could not be done
+}
+
+// Test case of a tool, as given by the tool test_data entry point
+type toolTest struct {
+	Name               string                 `json:"name"`
+	Test_index         int                    `json:"test_index"`
+	Inputs             map[string]interface{} `json:"inputs"`
+	Outputs            []toolTestOutput       `json:"outputs"`
+	Output_collections []json.RawMessage      `json:"output_collections"`
+	Required_files     []toolTestFile         `json:"required_files"`
+	Expect_failure     bool                   `json:"expect_failure"`
+	Maxseconds         int                    `json:"maxseconds"`
+	Error              bool                   `json:"error"`     // true if the test definition is invalid
+	Exception          string                 `json:"exception"` // reason of the invalid definition
+}
+
+// Expected output of a test case
+type toolTestOutput struct {
+	Name       string                   `json:"name"`
+	Value      string                   `json:"value"` // Expected file ("" if only assertions)
+	Attributes toolTestOutputAttributes `json:"attributes"`
+}
+
+type toolTestOutputAttributes struct {
+	Compare     string              `json:"compare"` // diff (default), contains, sim_size, etc.
+	Lines_diff  int                 `json:"lines_diff"`
+	Delta       *int64              `json:"delta"` // nil: DEFAULT_SIM_SIZE_DELTA
+	Delta_frac  *float64            `json:"delta_frac"`
+	Sort        bool                `json:"sort"`
+	Assert_list []toolTestAssertion `json:"assert_list"`
+}
+
+type toolTestAssertion struct {
+	Tag        string                 `json:"tag"` // has_text, has_line, etc.
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Input file of a test case
+type toolTestFile struct {
+	Name       string
+	Attributes struct {
+		Ftype          string        `json:"ftype"`
+		Dbkey          string        `json:"dbkey"`
+		Composite_data []interface{} `json:"composite_data"`
+	}
+}
+
+// Outputs are given as {"name", "value", "attributes"} objects,
+// or as [name, value, attributes] arrays by older galaxy versions.
+func (o *toolTestOutput) UnmarshalJSON(data []byte) (err error) {
+	type output toolTestOutput
+	var fields []json.RawMessage
+
+	if err = json.Unmarshal(data, (*output)(o)); err == nil {
+		return
+	}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	if len(fields) != 3 {
+		err = errors.New("Malformed tool test output: " + string(data))
+		return
+	}
+	if err = json.Unmarshal(fields[0], &o.Name); err != nil {
+		return
+	}
+	if err = json.Unmarshal(fields[1], &o.Value); err != nil {
+		return
+	}
+	err = json.Unmarshal(fields[2], &o.Attributes)
+	return
+}
+
+// Required files are given as [name, attributes] arrays
+func (f *toolTestFile) UnmarshalJSON(data []byte) (err error) {
+	var fields []json.RawMessage
+
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	if len(fields) != 2 {
+		err = errors.New("Malformed tool test file: " + string(data))
+		return
+	}
+	if err = json.Unmarshal(fields[0], &f.Name); err != nil {
+		return
+	}
+	err = json.Unmarshal(fields[1], &f.Attributes)
+	return
+}
+
+// Runs the functional tests of the tool defined by its id and version
+// ("": default version), like planemo does:
+//   - Test definitions and test data are downloaded from the galaxy instance
+//   - For each test case, input files are uploaded in a new history, the tool
+//     is launched and its outputs are compared with the expected files, using
+//     the diff, contains and sim_size comparisons and the has_text, not_has_text
+//     and has_line assertions. Other comparisons and assertions are not
+//     checked, and are reported in the Warnings of the test results
+//
+// The history is kept after the tests, it may be removed with DeleteHistory.
+//
+// Returns the report of the tests, err is not nil only if the tests
+// could not be run.
+func (g *Galaxy) RunToolTests(toolid, version string) (report *ToolTestReport, err error) {
+	var tests []toolTest
+	var history HistoryFullInfo
+	var uploaded map[string]string = make(map[string]string)
+
+	if tests, err = g.getToolTests(toolid, version); err != nil {
+		return
+	}
+	if len(tests) == 0 {
+		err = errors.New("Tool " + toolid + " has no test")
+		return
+	}
+
+	if history, err = g.CreateHistory("Tests of " + toolid); err != nil {
+		return
+	}
+
+	report = &ToolTestReport{
+		Tool_id:      toolid,
+		Tool_version: version,
+		History_id:   history.Id,
+		Tests:        make([]ToolTestResult, 0, len(tests)),
+	}
+	for _, t := range tests {
+		var result ToolTestResult = g.runToolTest(toolid, version, history.Id, t, uploaded)
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Tests = append(report.Tests, result)
+	}
+	return
+}
+
+// Returns the test cases of the tool defined by its id and version
+func (g *Galaxy) getToolTests(toolid, version string) (tests []toolTest, err error) {
+	var url string = g.url + TOOLS + "/" + toolid + "/test_data"
+
+	if version != "" {
+		url += "?tool_version=" + neturl.QueryEscape(version)
+	}
+	err = g.galaxyGetRequestJSONList(url, &tests, "Error while getting the tests of tool "+toolid)
+	return
+}
+
+// Downloads the given test data file of the tool defined by its id and version
+func (g *Galaxy) downloadToolTestData(toolid, version, filename string) (content []byte, err error) {
+	var params neturl.Values = neturl.Values{}
+	var buffer bytes.Buffer
+
+	params.Set("filename", filename)
+	if version != "" {
+		params.Set("tool_version", version)
+	}
+	if err = g.galaxyGetRequestWriter(g.url+TOOLS+"/"+toolid+"/test_data_download?"+params.Encode(), &buffer); err != nil {
+		return
+	}
+	content = buffer.Bytes()
+	return
+}
+
+// Runs a test case in the given history. uploaded contains the ids
+// of the test files already uploaded in the history (key: file name).
+func (g *Galaxy) runToolTest(toolid, version, historyid string, t toolTest, uploaded map[string]string) (result ToolTestResult) {
+	var tl *ToolLaunch
+	var answer toolResponse
+	var j job
+	var files map[string]toolTestFile = make(map[string]toolTestFile)
+	var names []string
+	var timeout int = DEFAULT_TOOL_TEST_TIMEOUT
+	var err error
+
+	result = ToolTestResult{Index: t.Test_index, Name: t.Name}
+
+	if t.Error {
+		result.Errors = append(result.Errors, "Invalid test definition: "+t.Exception)
+		return
+	}
+	if t.Maxseconds > 0 {
+		timeout = t.Maxseconds
+	}
+
+	for _, f := range t.Required_files {
+		files[f.Name] = f
+	}
+
+	tl = g.NewToolLauncher(historyid, toolid)
+	tl.SetToolVersion(version)
+
+	for name := range t.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = g.addToolTestInput(tl, toolid, version, name, t.Inputs[name], files, uploaded); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			return
+		}
+	}
+
+	if answer, err = g.launchTool(tl); err != nil || len(answer.Jobs) == 0 {
+		if t.Expect_failure {
+			result.Passed = true
+		} else if err != nil {
+			result.Errors = append(result.Errors, "Tool launch failed: "+err.Error())
+		} else {
+			result.Errors = append(result.Errors, "Tool launch returned no job")
+		}
+		return
+	}
+	result.Job_id = answer.Jobs[0].Id
+
+	if j, err = g.waitJob(result.Job_id, time.Duration(timeout)*time.Second); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
+
+	if t.Expect_failure {
+		if j.State == "ok" {
+			result.Errors = append(result.Errors, "Job succeeded but a failure was expected")
+		} else {
+			result.Passed = true
+		}
+		return
+	}
+	if j.State != "ok" {
+		result.Errors = append(result.Errors, "Job ended in state "+j.State)
+		return
+	}
+
+	for _, o := range t.Outputs {
+		errs, warnings := g.checkToolTestOutput(toolid, version, historyid, j, o)
+		result.Errors = append(result.Errors, errs...)
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+	if len(t.Output_collections) > 0 {
+		result.Warnings = append(result.Warnings, "Output collections are not checked")
+	}
+
+	result.Passed = len(result.Errors) == 0
+	return
+}
+
+// Adds the given test input to the ToolLaunch: Values that are test
+// files are uploaded (once) and given as datasets, other values are
+// given as parameters.
+func (g *Galaxy) addToolTestInput(tl *ToolLaunch, toolid, version, name string, value interface{}, files map[string]toolTestFile, uploaded map[string]string) (err error) {
+	var values []string
+	var datasets []toolInput
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, e := range v {
+			switch e.(type) {
+			case string, float64, bool:
+				values = append(values, fmt.Sprint(e))
+			default:
+				err = errors.New("Unsupported test input " + name)
+				return
+			}
+		}
+	case string, float64, bool:
+		values = []string{fmt.Sprint(v)}
+	case nil:
+		return
+	default:
+		err = errors.New("Unsupported test input " + name)
+		return
+	}
+
+	for _, v := range values {
+		var f toolTestFile
+		var ok bool
+		var id string
+
+		if f, ok = files[v]; !ok {
+			break
+		}
+		if id, err = g.uploadToolTestFile(tl.History_id, toolid, version, f, uploaded); err != nil {
+			return
+		}
+		datasets = append(datasets, toolInput{"hda", id, ""})
+	}
+
+	switch {
+	case len(values) > 0 && len(datasets) == len(values) && len(datasets) == 1:
+		tl.Inputs[name] = datasets[0]
+	case len(values) > 0 && len(datasets) == len(values):
+		tl.Inputs[name] = toolBatchInput{false, datasets}
+	case len(values) == 1:
+		tl.AddParameter(name, values[0])
+	default:
+		tl.AddParameterValues(name, values...)
+	}
+	return
+}
+
+// Uploads the given test file in the history, if not already uploaded,
+// and returns its dataset id
+func (g *Galaxy) uploadToolTestFile(historyid, toolid, version string, f toolTestFile, uploaded map[string]string) (id string, err error) {
+	var content []byte
+	var ftype string = "auto"
+	var ok bool
+
+	if id, ok = uploaded[f.Name]; ok {
+		return
+	}
+	if len(f.Attributes.Composite_data) > 0 {
+		err = errors.New("Composite test input " + f.Name + " is not supported")
+		return
+	}
+	if f.Attributes.Ftype != "" {
+		ftype = f.Attributes.Ftype
+	}
+
+	if content, err = g.downloadToolTestData(toolid, version, f.Name); err != nil {
+		return
+	}
+	if id, _, err = g.UploadReader(historyid, path.Base(f.Name), bytes.NewReader(content), ftype, &UploadOptions{Dbkey: f.Attributes.Dbkey}); err != nil {
+		return
+	}
+	uploaded[f.Name] = id
+	return
+}
+
+// Waits for the job defined by its id to be finished, and returns it
+func (g *Galaxy) waitJob(jobid string, timeout time.Duration) (j job, err error) {
+	var start time.Time = time.Now()
+
+	for {
+		if j, err = g.getJob(jobid); err != nil {
+			return
+		}
+		switch j.State {
+		case "ok", "error", "failed", "deleted", "deleted_new", "paused", "skipped":
+			return
+		}
+		if time.Since(start) > timeout {
+			err = errors.New("Job " + jobid + " not finished after " + timeout.String())
+			return
+		}
+		time.Sleep(TOOL_TEST_POLL_INTERVAL)
+	}
+}
+
+// Checks the given output of the job against the expected file and
+// assertions of the test, and returns the errors found, and the checks
+// that are not supported as warnings
+func (g *Galaxy) checkToolTestOutput(toolid, version, historyid string, j job, o toolTestOutput) (errs, warnings []string) {
+	var output toolInput
+	var ok bool
+	var compare bool
+	var asserts []toolTestAssertion
+	var content, expected []byte
+	var buffer bytes.Buffer
+	var dataset DatasetInfo
+	var err error
+
+	if output, ok = j.Outputs[o.Name]; !ok {
+		errs = []string{"Output " + o.Name + " not found"}
+		return
+	}
+
+	if compare, asserts, warnings = supportedToolTestChecks(o); !compare && len(asserts) == 0 {
+		return
+	}
+
+	// Only the size is needed: The output is not downloaded
+	if compare && o.Attributes.Compare == "sim_size" && len(asserts) == 0 {
+		if dataset, err = g.GetDataset(historyid, output.Id); err == nil {
+			expected, err = g.downloadToolTestData(toolid, version, o.Value)
+		}
+		if err == nil {
+			err = compareToolTestSizes(dataset.File_size, int64(len(expected)), o.Attributes)
+		}
+		if err != nil {
+			errs = append(errs, "Output "+o.Name+": "+err.Error())
+		}
+		return
+	}
+
+	if err = g.galaxyGetRequestWriter(g.url+HISTORY+"/"+historyid+"/contents/"+output.Id+"/display", &buffer); err != nil {
+		errs = []string{"Output " + o.Name + ": " + err.Error()}
+		return
+	}
+	content = buffer.Bytes()
+
+	if compare {
+		if expected, err = g.downloadToolTestData(toolid, version, o.Value); err != nil {
+			errs = []string{"Output " + o.Name + ": " + err.Error()}
+			return
+		}
+		if err = compareToolTestOutput(content, expected, o.Attributes); err != nil {
+			errs = append(errs, "Output "+o.Name+": "+err.Error())
+		}
+	}
+
+	for _, a := range asserts {
+		if err = checkToolTestAssertion(content, a); err != nil {
+			errs = append(errs, "Output "+o.Name+": "+err.Error())
+		}
+	}
+	return
+}
+
+// Returns whether the output is compared to an expected file with a
+// supported comparison mode, the supported assertions of the output, and
+// warnings for the comparison and assertions that are not supported
+func supportedToolTestChecks(o toolTestOutput) (compare bool, asserts []toolTestAssertion, warnings []string) {
+	if o.Value != "" {
+		if compare = toolTestComparisons[o.Attributes.Compare]; !compare {
+			warnings = append(warnings, "Output "+o.Name+": Unsupported comparison "+o.Attributes.Compare+" not checked")
+		}
+	}
+	for _, a := range o.Attributes.Assert_list {
+		if toolTestAssertions[a.Tag] {
+			asserts = append(asserts, a)
+		} else {
+			warnings = append(warnings, "Output "+o.Name+": Unsupported assertion "+a.Tag+" not checked")
+		}
+	}
+	return
+}
+
+// Compares the output with the expected file, following the
+// comparison mode of the test (diff, contains or sim_size)
+func compareToolTestOutput(output, expected []byte, attrs toolTestOutputAttributes) (err error) {
+	switch attrs.Compare {
+	case "", "diff":
+		var outlines, explines []string = textLines(output), textLines(expected)
+		var diff int
+		if attrs.Sort {
+			sort.Strings(outlines)
+			sort.Strings(explines)
+		}
+		if diff = linesDiff(outlines, explines, attrs.Lines_diff); diff > attrs.Lines_diff {
+			err = fmt.Errorf("More than %d lines differ from the expected file", attrs.Lines_diff)
+		}
+	case "contains":
+		var text string = normalizeNewlines(output)
+		var missing int
+		for _, l := range textLines(expected) {
+			if !strings.Contains(text, l) {
+				missing++
+			}
+		}
+		if missing > attrs.Lines_diff {
+			err = fmt.Errorf("%d lines of the expected file are not found (%d allowed)", missing, attrs.Lines_diff)
+		}
+	case "sim_size":
+		err = compareToolTestSizes(int64(len(output)), int64(len(expected)), attrs)
+	default:
+		err = errors.New("Unsupported comparison " + attrs.Compare)
+	}
+	return
+}
+
+// Checks that the size of the output is close to the size of the expected
+// file: The difference must not exceed delta bytes nor, if given, the
+// delta_frac fraction of the expected size
+func compareToolTestSizes(outsize, expsize int64, attrs toolTestOutputAttributes) (err error) {
+	var delta int64 = DEFAULT_SIM_SIZE_DELTA
+	var diff int64 = outsize - expsize
+
+	if attrs.Delta != nil {
+		delta = *attrs.Delta
+	}
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > delta {
+		err = fmt.Errorf("Size %d differs from expected size %d by more than %d bytes", outsize, expsize, delta)
+	} else if attrs.Delta_frac != nil && float64(diff) > math.Abs(*attrs.Delta_frac*float64(expsize)) {
+		err = fmt.Errorf("Size %d differs from expected size %d by more than %.1f%%", outsize, expsize, *attrs.Delta_frac*100)
+	}
+	return
+}
+
+// Checks the given assertion (has_text, not_has_text or has_line)
+// on the output
+func checkToolTestAssertion(output []byte, a toolTestAssertion) (err error) {
+	var text string = normalizeNewlines(output)
+
+	switch a.Tag {
+	case "has_text":
+		if t := fmt.Sprint(a.Attributes["text"]); !strings.Contains(text, t) {
+			err = errors.New("Text '" + t + "' not found")
+		}
+	case "not_has_text":
+		if t := fmt.Sprint(a.Attributes["text"]); strings.Contains(text, t) {
+			err = errors.New("Text '" + t + "' found")
+		}
+	case "has_line":
+		var l string = fmt.Sprint(a.Attributes["line"])
+		for _, line := range textLines(output) {
+			if line == l {
+				return
+			}
+		}
+		err = errors.New("Line '" + l + "' not found")
+	default:
+		err = errors.New("Unsupported assertion " + a.Tag)
+	}
+	return
+}
+
+func normalizeNewlines(content []byte) string {
+	return strings.Replace(string(content), "\r\n", "\n", -1)
+}
+
+// Splits the content in lines, without line separators
+func textLines(content []byte) []string {
+	var text string = strings.TrimSuffix(normalizeNewlines(content), "\n")
+
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
+
+// Returns the number of lines to remove and add to a to obtain b (Myers
+// algorithm), or max+1 if it is greater than max
+func linesDiff(a, b []string, max int) int {
+	var n, m int = len(a), len(b)
+	var offset int = max + 1
+	var v []int = make([]int, 2*max+3)
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x, y int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return d
+			}
+		}
+	}
+	return max + 1
+}
@@ -0,0 +1,113 @@
+package golaxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinesDiff(t *testing.T) {
+	var tests = []struct {
+		a, b []string
+		max  int
+		want int
+	}{
+		{[]string{}, []string{}, 0, 0},
+		{[]string{"a", "b"}, []string{"a", "b"}, 0, 0},
+		{[]string{"a"}, []string{}, 5, 1},
+		{[]string{}, []string{"a", "b"}, 5, 2},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c"}, 5, 2}, // modified line: removed + added
+		{[]string{"a", "b"}, []string{"b", "a", "c", "d"}, 5, 4},
+		{[]string{"a", "b", "c"}, []string{"x", "y", "z"}, 2, 3}, // more than max: max+1
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, 0, 1},
+	}
+
+	for i, test := range tests {
+		if got := linesDiff(test.a, test.b, test.max); got != test.want {
+			t.Errorf("Test %d: linesDiff(%v, %v, %d) = %d, expected %d", i, test.a, test.b, test.max, got, test.want)
+		}
+	}
+}
+
+func TestCompareToolTestOutput(t *testing.T) {
+	var frac float64 = 0.1
+	var delta, zero int64 = 10, 0
+	var tests = []struct {
+		output, expected string
+		attrs            toolTestOutputAttributes
+		ok               bool
+	}{
+		{"a\nb\n", "a\nb\n", toolTestOutputAttributes{}, true},
+		{"a\r\nb\r\n", "a\nb", toolTestOutputAttributes{Compare: "diff"}, true},
+		{"a\nx\n", "a\nb\n", toolTestOutputAttributes{}, false},
+		{"a\nx\n", "a\nb\n", toolTestOutputAttributes{Lines_diff: 1}, false},
+		{"a\nx\n", "a\nb\n", toolTestOutputAttributes{Lines_diff: 2}, true},
+		{"b\na\n", "a\nb\n", toolTestOutputAttributes{}, false},
+		{"b\na\n", "a\nb\n", toolTestOutputAttributes{Sort: true}, true},
+		{"header\na\nb\nfooter\n", "a\nb\n", toolTestOutputAttributes{Compare: "contains"}, true},
+		{"a\n", "a\nb\n", toolTestOutputAttributes{Compare: "contains"}, false},
+		{"a\n", "a\nb\n", toolTestOutputAttributes{Compare: "contains", Lines_diff: 1}, true},
+		{strings.Repeat("x", 100), strings.Repeat("x", 5000), toolTestOutputAttributes{Compare: "sim_size"}, true},
+		{strings.Repeat("x", 100), strings.Repeat("x", 20000), toolTestOutputAttributes{Compare: "sim_size"}, false},
+		{strings.Repeat("x", 100), strings.Repeat("x", 110), toolTestOutputAttributes{Compare: "sim_size", Delta: &delta}, true},
+		{strings.Repeat("x", 100), strings.Repeat("x", 111), toolTestOutputAttributes{Compare: "sim_size", Delta: &delta}, false},
+		{strings.Repeat("x", 100), strings.Repeat("x", 100), toolTestOutputAttributes{Compare: "sim_size", Delta: &zero}, true},
+		{strings.Repeat("x", 100), strings.Repeat("x", 101), toolTestOutputAttributes{Compare: "sim_size", Delta: &zero}, false},
+		{strings.Repeat("x", 100), strings.Repeat("x", 105), toolTestOutputAttributes{Compare: "sim_size", Delta_frac: &frac}, true},
+		{strings.Repeat("x", 100), strings.Repeat("x", 120), toolTestOutputAttributes{Compare: "sim_size", Delta_frac: &frac}, false},
+	}
+
+	for i, test := range tests {
+		err := compareToolTestOutput([]byte(test.output), []byte(test.expected), test.attrs)
+		if (err == nil) != test.ok {
+			t.Errorf("Test %d: compareToolTestOutput(%q, %q, %+v) returned %v", i, test.output, test.expected, test.attrs, err)
+		}
+	}
+}
+
+func TestCheckToolTestAssertion(t *testing.T) {
+	var tests = []struct {
+		output    string
+		assertion toolTestAssertion
+		ok        bool
+	}{
+		{"chr1\t10\n", toolTestAssertion{"has_text", map[string]interface{}{"text": "chr1"}}, true},
+		{"chr1\t10\n", toolTestAssertion{"has_text", map[string]interface{}{"text": "chr2"}}, false},
+		{"chr1\t10\n", toolTestAssertion{"not_has_text", map[string]interface{}{"text": "chr2"}}, true},
+		{"chr1\t10\n", toolTestAssertion{"not_has_text", map[string]interface{}{"text": "chr1"}}, false},
+		{"a\r\nchr1\t10\r\n", toolTestAssertion{"has_line", map[string]interface{}{"line": "chr1\t10"}}, true},
+		{"chr1\t10 extra\n", toolTestAssertion{"has_line", map[string]interface{}{"line": "chr1\t10"}}, false},
+	}
+
+	for i, test := range tests {
+		err := checkToolTestAssertion([]byte(test.output), test.assertion)
+		if (err == nil) != test.ok {
+			t.Errorf("Test %d: checkToolTestAssertion(%q, %+v) returned %v", i, test.output, test.assertion, err)
+		}
+	}
+}
+
+func TestSupportedToolTestChecks(t *testing.T) {
+	var tests = []struct {
+		output   toolTestOutput
+		compare  bool
+		asserts  int
+		warnings int
+	}{
+		{toolTestOutput{"out", "", toolTestOutputAttributes{}}, false, 0, 0},
+		{toolTestOutput{"out", "out.txt", toolTestOutputAttributes{}}, true, 0, 0},
+		{toolTestOutput{"out", "out.txt", toolTestOutputAttributes{Compare: "sim_size"}}, true, 0, 0},
+		{toolTestOutput{"out", "out.txt", toolTestOutputAttributes{Compare: "re_match"}}, false, 0, 1},
+		{toolTestOutput{"out", "", toolTestOutputAttributes{Assert_list: []toolTestAssertion{
+			{"has_text", map[string]interface{}{"text": "chr1"}},
+			{"has_n_lines", map[string]interface{}{"n": 1}},
+			{"is_valid_xml", nil},
+		}}}, false, 1, 2},
+	}
+
+	for i, test := range tests {
+		compare, asserts, warnings := supportedToolTestChecks(test.output)
+		if compare != test.compare || len(asserts) != test.asserts || len(warnings) != test.warnings {
+			t.Errorf("Test %d: supportedToolTestChecks(%+v) = %v, %v, %v", i, test.output, compare, asserts, warnings)
+		}
+	}
+}
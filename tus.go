@@ -0,0 +1,295 @@
+package golaxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	TUS_VERSION            = "1.0.0"
+	DEFAULT_TUS_CHUNK_SIZE = 10 * 1024 * 1024
+)
+
+// Options of a resumable upload
+type ResumableUploadOptions struct {
+	UploadOptions
+
+	// Size of the chunk sent by each request (default: DEFAULT_TUS_CHUNK_SIZE)
+	Chunk_size int64
+	// Local file in which the upload url is saved. If it exists when the upload
+	// starts, the upload is resumed from the offset known by the server.
+	// It is removed once the upload is complete (default: no resume).
+	Resume_file string
+}
+
+// Uploads the given local file to the galaxy instance in the history
+// defined by its id, with the given type (auto/txt/nhx/etc.), using the
+// resumable upload (TUS protocol) entry point.
+//
+// The file is sent by chunks of opts.Chunk_size bytes, opts.Progress is called
+// after each chunk, and the upload can be resumed after an interruption if
+// opts.Resume_file is given. Once the file is uploaded, it is added to the
+// history (see UploadResumableSession).
+//
+// opts may be nil, default options are used in that case.
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) UploadFileResumable(historyid, path, ftype string, opts *ResumableUploadOptions) (fileid, jobid string, err error) {
+	var sessionid string
+	var uploadopts *UploadOptions
+
+	if historyid == "" {
+		err = errors.New("UploadFileResumable input history id is not valid")
+		return
+	}
+
+	if sessionid, err = g.TusUploadFile(path, opts); err != nil {
+		return
+	}
+
+	if opts != nil {
+		uploadopts = &opts.UploadOptions
+	}
+	fileid, jobid, err = g.UploadResumableSession(historyid, sessionid, filepath.Base(path), ftype, uploadopts)
+	return
+}
+
+// Adds a file already uploaded with TusUploadFile (defined by its session id)
+// to the history defined by its id, with the given name and type (auto/txt/nhx/etc.).
+//
+// opts may be nil, default options are used in that case.
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) UploadResumableSession(historyid, sessionid, name, ftype string, opts *UploadOptions) (fileid, jobid string, err error) {
+	var element fetchElement
+	var answer toolResponse
+
+	if historyid == "" {
+		err = errors.New("UploadResumableSession input history id is not valid")
+		return
+	}
+
+	element = newFetchElement("files", ftype, opts)
+	if element.Name == "" {
+		element.Name = name
+	}
+
+	if answer, err = g.fetch(fetchRequest{
+		History_id: historyid,
+		Targets:    []fetchTarget{{Destination: fetchDestination{"hdas"}, Elements: []fetchElement{element}}},
+		Files:      []fetchSessionFile{{sessionid, name}},
+	}); err != nil {
+		return
+	}
+	fileid, jobid, err = singleUploadResult(answer)
+	return
+}
+
+// Uploads the given local file to the resumable upload (TUS protocol)
+// entry point of the galaxy instance.
+//
+// The file is not added to any history: The returned session id must be
+// given to UploadResumableSession to do so.
+//
+// opts may be nil, default options are used in that case.
+func (g *Galaxy) TusUploadFile(path string, opts *ResumableUploadOptions) (sessionid string, err error) {
+	var file *os.File
+	var stat os.FileInfo
+	var uploadurl string
+	var offset int64 = -1
+	var chunksize int64 = DEFAULT_TUS_CHUNK_SIZE
+	var resumefile string
+	var progress func(UploadProgress)
+	var tracker *progressTracker
+	var content []byte
+	var name string = filepath.Base(path)
+	var failures int
+
+	if opts != nil {
+		if opts.Chunk_size > 0 {
+			chunksize = opts.Chunk_size
+		}
+		resumefile = opts.Resume_file
+		progress = opts.Progress
+	}
+
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+	defer file.Close()
+
+	if stat, err = file.Stat(); err != nil {
+		return
+	}
+
+	// Resumes a previous upload if possible
+	if resumefile != "" {
+		if content, err = ioutil.ReadFile(resumefile); err == nil {
+			uploadurl = strings.TrimSpace(string(content))
+			if offset, err = g.tusOffset(uploadurl); err != nil {
+				// Upload unknown to the server: We start a new one
+				offset = -1
+			}
+		}
+		err = nil
+	}
+
+	if offset < 0 {
+		if uploadurl, err = g.tusCreate(name, stat.Size()); err != nil {
+			return
+		}
+		offset = 0
+		if resumefile != "" {
+			if err = ioutil.WriteFile(resumefile, []byte(uploadurl), 0600); err != nil {
+				return
+			}
+		}
+	}
+
+	tracker = newProgressTracker(name, offset, stat.Size(), progress)
+
+	for offset < stat.Size() {
+		var newoffset int64
+		var length int64 = chunksize
+
+		if stat.Size()-offset < length {
+			length = stat.Size() - offset
+		}
+
+		if newoffset, err = g.tusPatch(uploadurl, offset, io.NewSectionReader(file, offset, length)); err != nil {
+			failures++
+			if failures >= g.requestattempts {
+				return
+			}
+			// We ask the server where we are before retrying
+			if newoffset, err = g.tusOffset(uploadurl); err != nil {
+				return
+			}
+		} else if newoffset <= offset {
+			err = errors.New("Error while uploading the file : Upload does not progress")
+			return
+		} else {
+			failures = 0
+		}
+		offset = newoffset
+		tracker.set(offset)
+	}
+	tracker.finish()
+
+	if resumefile != "" {
+		if err = os.Remove(resumefile); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+	}
+
+	sessionid = uploadurl[strings.LastIndex(uploadurl, "/")+1:]
+	return
+}
+
+// Creates a new upload on the resumable upload entry point
+// and returns its url
+func (g *Galaxy) tusCreate(name string, size int64) (uploadurl string, err error) {
+	var response *http.Response
+	var location *neturl.URL
+
+	if response, err = g.tusRequest("POST", g.url+TUS_UPLOAD, nil, map[string]string{
+		"Upload-Length":   strconv.FormatInt(size, 10),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(name)),
+	}); err != nil {
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		err = errors.New("Error while creating the resumable upload: " + response.Status)
+		return
+	}
+
+	if location, err = response.Location(); err != nil {
+		err = errors.New("Error while creating the resumable upload: " + err.Error())
+		return
+	}
+	uploadurl = location.String()
+	return
+}
+
+// Returns the offset of the upload known by the server
+func (g *Galaxy) tusOffset(uploadurl string) (offset int64, err error) {
+	var response *http.Response
+
+	if response, err = g.tusRequest("HEAD", uploadurl, nil, nil); err != nil {
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		err = errors.New("Error while getting the offset of the resumable upload: " + response.Status)
+		return
+	}
+	offset, err = strconv.ParseInt(response.Header.Get("Upload-Offset"), 10, 64)
+	return
+}
+
+// Sends the given chunk to the server, starting at the given offset,
+// and returns the new offset given by the server
+func (g *Galaxy) tusPatch(uploadurl string, offset int64, chunk *io.SectionReader) (newoffset int64, err error) {
+	var response *http.Response
+
+	if response, err = g.tusRequest("PATCH", uploadurl, chunk, map[string]string{
+		"Upload-Offset": strconv.FormatInt(offset, 10),
+		"Content-Type":  "application/offset+octet-stream",
+	}); err != nil {
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		err = errors.New("Error while sending a chunk of the resumable upload: " + response.Status)
+		return
+	}
+	newoffset, err = strconv.ParseInt(response.Header.Get("Upload-Offset"), 10, 64)
+	return
+}
+
+// Sends a request of the TUS protocol, with the given method, body and headers.
+//
+// Requests sending a chunk have no overall timeout, as sending a chunk may
+// take long on slow connections.
+func (g *Galaxy) tusRequest(method, url string, body *io.SectionReader, headers map[string]string) (response *http.Response, err error) {
+	var req *http.Request
+	var client *http.Client = g.newClient()
+
+	if body != nil {
+		req, err = http.NewRequest(method, url, body)
+	} else {
+		req, err = http.NewRequest(method, url, nil)
+	}
+	if err != nil {
+		err = g.hideKeyFromError(err)
+		return
+	}
+	if body != nil {
+		req.ContentLength = body.Size()
+		client = g.newClientWithTimeout(0)
+	}
+	req.Header.Set("x-api-key", g.apikey)
+	req.Header.Set("Tus-Resumable", TUS_VERSION)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if response, err = client.Do(req); err != nil {
+		err = errors.New(fmt.Sprintf("Error while sending %s request: %s", method, g.hideKeyFromError(err).Error()))
+	}
+	return
+}
@@ -0,0 +1,674 @@
+package golaxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Options of an upload
+type UploadOptions struct {
+	Dbkey           string   // Genome build of the new dataset (default: "?")
+	Name            string   // Name of the new dataset (default: given by the server, from the file name or url)
+	Ext             string   // Type of the new dataset, overrides the type given to the upload function if not empty
+	To_posix_lines  bool     // Converts line endings to POSIX line endings
+	Space_to_tab    bool     // Converts spaces to tabs
+	Auto_decompress bool     // Decompresses gz/bz2/zip files
+	Tags            []string // Tags of the new dataset ("name:sample1" for example)
+
+	// If true, UploadFileWithOptions does not upload a file whose content is
+	// already in the target history, or in Cache_history if given: a dataset
+	// in state "ok" having the same SHA-1 hash (stored by the server) and size
+	// is reused, or copied to the target history. Files uploaded with this
+	// option have their hash stored by the server, and are copied to
+	// Cache_history (best effort: a failed copy is not reported).
+	Deduplicate   bool
+	Cache_history string // Id of the history searched for duplicates (default: the target history)
+
+	// Called while the data is sent (may be nil). It is given a copy of the
+	// progress of this upload only, so the same function may be given to
+	// several uploads running in parallel, as long as it is itself safe
+	// for concurrent use. It is not called when the data does not go through
+	// the client (UploadURL for example).
+	Progress func(UploadProgress)
+}
+
+// Request to the data fetch entry point (/api/tools/fetch)
+type fetchRequest struct {
+	History_id string             `json:"history_id"`
+	Targets    []fetchTarget      `json:"targets"`
+	Files      []fetchSessionFile `json:"-"` // Files already uploaded with the resumable upload entry point
+}
+
+// File already uploaded with the resumable upload entry point,
+// corresponding to an element having src "files"
+type fetchSessionFile struct {
+	Session_id string `json:"session_id"`
+	Name       string `json:"name"`
+}
+
+// Files uploaded with the resumable upload entry point are given as top
+// level "files_<index>|file_data" keys, the index being the rank of the
+// element having src "files" in the targets.
+func (r fetchRequest) MarshalJSON() ([]byte, error) {
+	var payload map[string]interface{} = map[string]interface{}{
+		"history_id": r.History_id,
+		"targets":    r.Targets,
+	}
+
+	for i, f := range r.Files {
+		payload[fmt.Sprintf("files_%d|file_data", i)] = f
+	}
+	return json.Marshal(payload)
+}
+
+// Target of a data fetch request: where and what to upload
+type fetchTarget struct {
+	Destination     fetchDestination `json:"destination"`
+	Elements        []fetchElement   `json:"elements"`
+	Collection_type string           `json:"collection_type,omitempty"` // If destination is "hdca": list, paired, list:paired, etc.
+	Name            string           `json:"name,omitempty"`            // If destination is "hdca": name of the collection
+}
+
+type fetchDestination struct {
+	Type string `json:"type"` // "hdas": datasets of the history, "hdca": new collection in the history
+}
+
+// Element to upload with a data fetch request
+type fetchElement struct {
+	Src             string          `json:"src,omitempty"`             // "url", "pasted", "files", "ftp_import", "composite" ("" for nested collections)
+	Url             string          `json:"url,omitempty"`             // If Src=="url"
+	Paste_content   string          `json:"paste_content,omitempty"`   // If Src=="pasted"
+	Ftp_path        string          `json:"ftp_path,omitempty"`        // If Src=="ftp_import"
+	Ext             string          `json:"ext,omitempty"`             // Type of the dataset (auto/txt/nhx/etc.)
+	Dbkey           string          `json:"dbkey,omitempty"`           // Genome build
+	Name            string          `json:"name,omitempty"`            // Name of the dataset, or element identifier in a collection
+	To_posix_lines  bool            `json:"to_posix_lines,omitempty"`  // Converts line endings
+	Space_to_tab    bool            `json:"space_to_tab,omitempty"`    // Converts spaces to tabs
+	Auto_decompress bool            `json:"auto_decompress,omitempty"` // Decompresses compressed files
+	Tags            []string        `json:"tags,omitempty"`            // Tags of the dataset
+	Elements        []fetchElement  `json:"elements,omitempty"`        // Elements of a nested collection
+	Composite       *fetchComposite `json:"composite,omitempty"`       // If Src=="composite"
+	Hashes          []DatasetHash   `json:"hashes,omitempty"`          // Hashes of the content, checked and stored by the server
+}
+
+// Components of a composite dataset
+type fetchComposite struct {
+	Items []fetchElement `json:"items"`
+}
+
+// File sent in the multipart body of a data fetch request
+type fetchFile struct {
+	name    string           // Name of the file
+	reader  io.Reader        // Content of the file
+	size    int64            // Size of the file, -1 if unknown
+	tracker *progressTracker // Progress of the upload of the file
+}
+
+// Builds a file to send in a data fetch request, whose progress
+// is given to the given callback (may be nil)
+func newFetchFile(name string, r io.Reader, progress func(UploadProgress)) fetchFile {
+	var size int64 = readerSize(r)
+	return fetchFile{name, r, size, newProgressTracker(name, 0, size, progress)}
+}
+
+// Returns the progress callback of the options, nil if opts is nil
+func (opts *UploadOptions) progressCallback() func(UploadProgress) {
+	if opts == nil {
+		return nil
+	}
+	return opts.Progress
+}
+
+// Builds a data fetch element with the given source, type and options
+func newFetchElement(src, ftype string, opts *UploadOptions) (element fetchElement) {
+	element = fetchElement{
+		Src:   src,
+		Ext:   ftype,
+		Dbkey: "?",
+	}
+	if opts != nil {
+		if opts.Dbkey != "" {
+			element.Dbkey = opts.Dbkey
+		}
+		if opts.Ext != "" {
+			element.Ext = opts.Ext
+		}
+		element.Name = opts.Name
+		element.To_posix_lines = opts.To_posix_lines
+		element.Space_to_tab = opts.Space_to_tab
+		element.Auto_decompress = opts.Auto_decompress
+		element.Tags = opts.Tags
+	}
+	return
+}
+
+// Uploads the data located at the given url to the galaxy instance in the history
+// defined by its id, with the given type (auto/txt/nhx/etc.).
+//
+// The data is fetched by the Galaxy server itself (http, https or ftp urls),
+// it does not go through the client.
+//
+// opts may be nil, default options are used in that case.
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) UploadURL(historyid, url, ftype string, opts *UploadOptions) (fileid, jobid string, err error) {
+	var element fetchElement
+
+	if historyid == "" {
+		err = errors.New("UploadURL input history id is not valid")
+		return
+	}
+
+	element = newFetchElement("url", ftype, opts)
+	element.Url = url
+
+	fileid, jobid, err = g.fetchSingle(historyid, element)
+	return
+}
+
+// Uploads the content read from r to the galaxy instance in the history
+// defined by its id, with the given name and type (auto/txt/nhx/etc.).
+//
+// The content is streamed to the server, it is not loaded in memory.
+//
+// opts may be nil, default options are used in that case.
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) UploadReader(historyid, name string, r io.Reader, ftype string, opts *UploadOptions) (fileid, jobid string, err error) {
+	if historyid == "" {
+		err = errors.New("UploadReader input history id is not valid")
+		return
+	}
+	fileid, jobid, err = g.uploadReader(historyid, name, r, ftype, opts, nil)
+	return
+}
+
+// Uploads the content read from r, whose hashes may be given to the server
+// (may be nil).
+func (g *Galaxy) uploadReader(historyid, name string, r io.Reader, ftype string, opts *UploadOptions, hashes []DatasetHash) (fileid, jobid string, err error) {
+	var element fetchElement
+	var answer toolResponse
+
+	element = newFetchElement("files", ftype, opts)
+	element.Hashes = hashes
+	if element.Name == "" {
+		element.Name = name
+	}
+
+	if answer, err = g.fetchMultipart(historyid, []fetchTarget{{Destination: fetchDestination{"hdas"}, Elements: []fetchElement{element}}}, []fetchFile{newFetchFile(name, r, opts.progressCallback())}); err != nil {
+		return
+	}
+	fileid, jobid, err = singleUploadResult(answer)
+	return
+}
+
+// Uploads the given content (pasted content) to the galaxy instance in the history
+// defined by its id, with the given name and type (auto/txt/nhx/etc.).
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) UploadContent(historyid, name string, content []byte, ftype string) (fileid, jobid string, err error) {
+	var element fetchElement
+
+	if historyid == "" {
+		err = errors.New("UploadContent input history id is not valid")
+		return
+	}
+
+	element = newFetchElement("pasted", ftype, nil)
+	element.Paste_content = string(content)
+	element.Name = name
+
+	fileid, jobid, err = g.fetchSingle(historyid, element)
+	return
+}
+
+// Uploads the given local files as a single dataset of the given composite
+// type (pbed, affybatch, shapefile, velvet, html, etc.) to the galaxy instance
+// in the history defined by its id.
+//
+// Paths must be given in the order of the components of the composite type:
+// they are sent as components files_0, files_1, etc. For pbed for example:
+// the .bim, .bed and .fam files.
+//
+// opts may be nil, default options are used in that case. The name of the
+// dataset is the base name of the first file (without extension) if not
+// given in opts.
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) UploadComposite(historyid string, paths []string, ftype string, opts *UploadOptions) (fileid, jobid string, err error) {
+	var element fetchElement
+	var files []fetchFile
+	var opened []*os.File
+	var answer toolResponse
+
+	if historyid == "" {
+		err = errors.New("UploadComposite input history id is not valid")
+		return
+	}
+	if len(paths) == 0 {
+		err = errors.New("UploadComposite: No file to upload")
+		return
+	}
+
+	element = newFetchElement("composite", ftype, opts)
+	if element.Name == "" {
+		element.Name = strings.TrimSuffix(filepath.Base(paths[0]), filepath.Ext(paths[0]))
+	}
+	element.Composite = &fetchComposite{make([]fetchElement, 0, len(paths))}
+
+	files = make([]fetchFile, 0, len(paths))
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+
+	for _, p := range paths {
+		var file *os.File
+		if file, err = os.Open(p); err != nil {
+			return
+		}
+		opened = append(opened, file)
+		files = append(files, newFetchFile(filepath.Base(p), file, opts.progressCallback()))
+		element.Composite.Items = append(element.Composite.Items, fetchElement{Src: "files"})
+	}
+
+	if answer, err = g.fetchMultipart(historyid, []fetchTarget{{Destination: fetchDestination{"hdas"}, Elements: []fetchElement{element}}}, files); err != nil {
+		return
+	}
+	fileid, jobid, err = singleUploadResult(answer)
+	return
+}
+
+// Item of a batch upload (see UploadFiles).
+//
+// Exactly one of Path, Url or Content must be given.
+type UploadItem struct {
+	Path    string         // Local file to upload
+	Url     string         // Url of the data, fetched by the Galaxy server
+	Content []byte         // Content to upload (pasted content)
+	Name    string         // Name of the dataset (default: base name of Path, given by the server otherwise)
+	Ftype   string         // Type of the dataset (default: "auto")
+	Options *UploadOptions // Options of the upload (may be nil)
+}
+
+// Uploads all the given items (local files, urls and pasted contents) to the
+// galaxy instance in the history defined by its id, in a single request.
+//
+// Only one upload job is created for all the items. Deduplication is not
+// supported: an error is returned if an item has the Deduplicate option
+// (see UploadFileWithOptions).
+//
+// Returns the file ids, in the same order as the items, the job id and a
+// potential error
+func (g *Galaxy) UploadFiles(historyid string, items []UploadItem) (fileids []string, jobid string, err error) {
+	var elements []fetchElement
+	var files []fetchFile
+	var opened []*os.File
+	var answer toolResponse
+	var ftype string
+
+	if historyid == "" {
+		err = errors.New("UploadFiles input history id is not valid")
+		return
+	}
+	if len(items) == 0 {
+		err = errors.New("UploadFiles: No item to upload")
+		return
+	}
+
+	elements = make([]fetchElement, 0, len(items))
+	files = make([]fetchFile, 0, len(items))
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+
+	for i, item := range items {
+		var element fetchElement
+		var file *os.File
+
+		if item.Options != nil && item.Options.Deduplicate {
+			err = errors.New(fmt.Sprintf("UploadFiles: Item %d: Deduplicate is not supported by batch uploads", i))
+			return
+		}
+		if ftype = item.Ftype; ftype == "" {
+			ftype = "auto"
+		}
+
+		switch {
+		case item.Path != "" && item.Url == "" && item.Content == nil:
+			element = newFetchElement("files", ftype, item.Options)
+			if file, err = os.Open(item.Path); err != nil {
+				return
+			}
+			opened = append(opened, file)
+			files = append(files, newFetchFile(filepath.Base(item.Path), file, item.Options.progressCallback()))
+			if item.Name == "" {
+				item.Name = filepath.Base(item.Path)
+			}
+		case item.Path == "" && item.Url != "" && item.Content == nil:
+			element = newFetchElement("url", ftype, item.Options)
+			element.Url = item.Url
+		case item.Path == "" && item.Url == "" && item.Content != nil:
+			element = newFetchElement("pasted", ftype, item.Options)
+			element.Paste_content = string(item.Content)
+		default:
+			err = errors.New(fmt.Sprintf("UploadFiles: Item %d must have exactly one of Path, Url or Content", i))
+			return
+		}
+		if element.Name == "" {
+			element.Name = item.Name
+		}
+		elements = append(elements, element)
+	}
+
+	targets := []fetchTarget{{Destination: fetchDestination{"hdas"}, Elements: elements}}
+	if len(files) > 0 {
+		answer, err = g.fetchMultipart(historyid, targets, files)
+	} else {
+		answer, err = g.fetch(fetchRequest{History_id: historyid, Targets: targets})
+	}
+	if err != nil {
+		return
+	}
+
+	if fileids, err = orderedFetchOutputs(answer, len(items)); err != nil {
+		return
+	}
+	if len(answer.Jobs) != 1 {
+		err = errors.New("Error while uploading the files : Number of Jobs")
+		return
+	}
+	jobid = answer.Jobs[0].Id
+	return
+}
+
+// Returns the ids of the datasets created by a data fetch request, in the
+// order of the uploaded elements.
+//
+// Outputs of the data fetch tool are named "output<index of the element>".
+func orderedFetchOutputs(answer toolResponse, nbelements int) (fileids []string, err error) {
+	if len(answer.Outputs) != nbelements {
+		err = errors.New("Error while uploading the files : Number of Outputs")
+		return
+	}
+
+	fileids = make([]string, nbelements)
+	for i, o := range answer.Outputs {
+		var index int
+		if _, err2 := fmt.Sscanf(o.Output_Name, "output%d", &index); err2 != nil || index < 0 || index >= nbelements || fileids[index] != "" {
+			// Unexpected output names: We keep the server order
+			for j, o2 := range answer.Outputs {
+				fileids[j] = o2.Id
+			}
+			return
+		}
+		fileids[index] = answer.Outputs[i].Id
+	}
+	return
+}
+
+// File of the user FTP/import directory of the galaxy instance
+type FTPFile struct {
+	Path  string `json:"path"`  // Path relative to the user directory
+	Size  int64  `json:"size"`  // Size in bytes
+	Ctime string `json:"ctime"` // Creation time
+}
+
+// Lists the files of the user FTP/import directory of the galaxy instance
+func (g *Galaxy) ListFTPFiles() (files []FTPFile, err error) {
+	var url string = g.url + FTP_FILES
+
+	err = g.galaxyGetRequestJSONList(url, &files, "Error while listing FTP files")
+	return
+}
+
+// Imports the given files of the user FTP/import directory (paths as given by
+// ListFTPFiles) to the history defined by its id, with the given type
+// (auto/txt/nhx/etc.), in a single request.
+//
+// Depending on the configuration of the galaxy instance, imported files
+// may be removed from the FTP directory.
+//
+// Returns the file ids, in the same order as the paths, the job id and a
+// potential error
+func (g *Galaxy) ImportFTPFiles(historyid string, paths []string, ftype string) (fileids []string, jobid string, err error) {
+	var elements []fetchElement
+	var answer toolResponse
+
+	if historyid == "" {
+		err = errors.New("ImportFTPFiles input history id is not valid")
+		return
+	}
+	if len(paths) == 0 {
+		err = errors.New("ImportFTPFiles: No file to import")
+		return
+	}
+
+	elements = make([]fetchElement, 0, len(paths))
+	for _, p := range paths {
+		element := newFetchElement("ftp_import", ftype, nil)
+		element.Ftp_path = p
+		element.Name = path.Base(p)
+		elements = append(elements, element)
+	}
+
+	if answer, err = g.fetch(fetchRequest{History_id: historyid, Targets: []fetchTarget{{Destination: fetchDestination{"hdas"}, Elements: elements}}}); err != nil {
+		return
+	}
+
+	if fileids, err = orderedFetchOutputs(answer, len(paths)); err != nil {
+		return
+	}
+	if len(answer.Jobs) != 1 {
+		err = errors.New("Error while importing the files : Number of Jobs")
+		return
+	}
+	jobid = answer.Jobs[0].Id
+	return
+}
+
+// Uploads a single element to the given history using the data fetch entry point.
+//
+// Returns the file id, the job id and a potential error
+func (g *Galaxy) fetchSingle(historyid string, element fetchElement) (fileid, jobid string, err error) {
+	var answer toolResponse
+
+	if answer, err = g.fetch(fetchRequest{History_id: historyid, Targets: []fetchTarget{{Destination: fetchDestination{"hdas"}, Elements: []fetchElement{element}}}}); err != nil {
+		return
+	}
+	fileid, jobid, err = singleUploadResult(answer)
+	return
+}
+
+// Returns the file id and the job id of an upload of a single dataset
+func singleUploadResult(answer toolResponse) (fileid, jobid string, err error) {
+	if len(answer.Outputs) != 1 {
+		err = errors.New("Error while uploading the file : Number of Outputs")
+		return
+	}
+	fileid = answer.Outputs[0].Id
+
+	if len(answer.Jobs) != 1 {
+		err = errors.New("Error while uploading the file : Number of Jobs")
+		return
+	}
+	jobid = answer.Jobs[0].Id
+	return
+}
+
+// Sends the given request to the data fetch entry point of the galaxy instance
+func (g *Galaxy) fetch(request fetchRequest) (answer toolResponse, err error) {
+	var url string = g.url + TOOLS_FETCH
+	var input []byte
+
+	if input, err = json.Marshal(request); err != nil {
+		err = errors.New("Error while marshaling fetch request: " + err.Error())
+		return
+	}
+
+	if err = g.galaxyPostRequestJSON(url, input, &answer); err != nil {
+		return
+	}
+
+	if answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+	}
+	return
+}
+
+// Sends the given targets to the data fetch entry point of the galaxy instance,
+// together with the content of the given files, in a multipart form.
+//
+// Elements of the targets having src "files" correspond, in order, to the given files.
+//
+// The multipart body is written to the request while it is sent, so files
+// are never loaded in memory. If the sizes of all the files are known, the
+// length of the body is computed beforehand, otherwise it is sent chunked.
+func (g *Galaxy) fetchMultipart(historyid string, targets []fetchTarget, files []fetchFile) (answer toolResponse, err error) {
+	var url string = g.url + TOOLS_FETCH
+	var targetsjson []byte
+	var r *io.PipeReader
+	var w *io.PipeWriter
+	var writer *multipart.Writer
+	var postrequest *http.Request
+	var postresponse *http.Response
+	var body []byte
+	var length int64
+	var done chan struct{} = make(chan struct{})
+
+	if targetsjson, err = json.Marshal(targets); err != nil {
+		err = errors.New("Error while marshaling fetch targets: " + err.Error())
+		return
+	}
+
+	r, w = io.Pipe()
+	writer = multipart.NewWriter(w)
+
+	if length, err = multipartLength(writer.Boundary(), historyid, targetsjson, files); err != nil {
+		return
+	}
+
+	go func() {
+		defer close(done)
+		if err2 := writeFetchForm(writer, historyid, targetsjson, files, true); err2 != nil {
+			w.CloseWithError(err2)
+			return
+		}
+		w.Close()
+	}()
+
+	if postrequest, err = http.NewRequest("POST", url, r); err != nil {
+		r.Close()
+		<-done
+		err = errors.New("Error while creating new POST request: " + g.hideKeyFromError(err).Error())
+		return
+	}
+	postrequest.ContentLength = length
+	postrequest.Header.Set("Content-Type", writer.FormDataContentType())
+	postrequest.Header.Set("x-api-key", g.apikey)
+
+	// No global timeout: Uploads may last for hours
+	if postresponse, err = g.newClientWithTimeout(0).Do(postrequest); err != nil {
+		r.Close()
+		<-done
+		err = errors.New("Error while POSTing form: " + g.hideKeyFromError(err).Error())
+		return
+	}
+	defer postresponse.Body.Close()
+
+	// The server may answer before reading the whole body: The writer is
+	// stopped, and the trackers are not used anymore once it is finished
+	r.Close()
+	<-done
+	for _, f := range files {
+		f.tracker.finish()
+	}
+
+	if body, err = ioutil.ReadAll(postresponse.Body); err != nil {
+		err = errors.New("Error while reading server response: " + err.Error())
+		return
+	}
+
+	if err = json.Unmarshal(body, &answer); err != nil {
+		err = errors.New("Error while unmarshaling server response: " + err.Error())
+		return
+	}
+
+	if answer.Err_msg != "" {
+		err = errors.New(answer.Err_msg)
+	}
+	return
+}
+
+// Writes the multipart form of a data fetch request: history id, targets,
+// and files.
+//
+// If content is false, the content of the files is not written (used to
+// compute the length of the form), otherwise the bytes of the files are
+// given to their trackers while they are written.
+func writeFetchForm(writer *multipart.Writer, historyid string, targetsjson []byte, files []fetchFile, content bool) (err error) {
+	var part io.Writer
+
+	if err = writer.WriteField("history_id", historyid); err != nil {
+		err = errors.New("Error while writing history id to form: " + err.Error())
+		return
+	}
+	if err = writer.WriteField("targets", string(targetsjson)); err != nil {
+		err = errors.New("Error while writing targets to form: " + err.Error())
+		return
+	}
+	for i, f := range files {
+		if part, err = writer.CreateFormFile(fmt.Sprintf("files_%d|file_data", i), f.name); err != nil {
+			err = errors.New("Error while creating upload file form: " + err.Error())
+			return
+		}
+		if !content {
+			continue
+		}
+		if _, err = io.Copy(part, &progressReader{f.reader, f.tracker}); err != nil {
+			err = errors.New("Error while copying file content to form: " + err.Error())
+			return
+		}
+	}
+	err = writer.Close()
+	return
+}
+
+// Computes the length of the multipart form of a data fetch request, by
+// encoding it without the file contents, with the given boundary.
+//
+// Returns -1 if the size of one of the files is unknown.
+func multipartLength(boundary, historyid string, targetsjson []byte, files []fetchFile) (length int64, err error) {
+	var buffer bytes.Buffer
+	var writer *multipart.Writer = multipart.NewWriter(&buffer)
+
+	for _, f := range files {
+		if f.size < 0 {
+			length = -1
+			return
+		}
+		length += f.size
+	}
+
+	if err = writer.SetBoundary(boundary); err != nil {
+		return
+	}
+	if err = writeFetchForm(writer, historyid, targetsjson, files, false); err != nil {
+		return
+	}
+	length += int64(buffer.Len())
+	return
+}
@@ -0,0 +1,156 @@
+package golaxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Fake data fetch entry point checking that the announced length of the
+// multipart body is the number of bytes actually received
+func newFetchServer(t *testing.T, chunked bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		var err error
+
+		if r.URL.Path != TOOLS_FETCH {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			t.Errorf("Error while reading body: %v", err)
+		}
+		if chunked && r.ContentLength != -1 {
+			t.Errorf("Expected chunked body, got Content-Length %d", r.ContentLength)
+		}
+		if !chunked && r.ContentLength != int64(len(body)) {
+			t.Errorf("Content-Length %d does not match body length %d", r.ContentLength, len(body))
+		}
+		if names := multipartFieldNames(t, r.Header.Get("Content-Type"), body); strings.Join(names, ",") != "history_id,targets,files_0|file_data" {
+			t.Errorf("Unexpected form fields %v", names)
+		}
+		w.Write([]byte(`{"outputs":[{"id":"d1","output_name":"output0"}],"jobs":[{"id":"j1"}]}`))
+	}))
+}
+
+// Returns the names of the fields of the given multipart body
+func multipartFieldNames(t *testing.T, contenttype string, body []byte) (names []string) {
+	var params map[string]string
+	var reader *multipart.Reader
+	var part *multipart.Part
+	var err error
+
+	if _, params, err = mime.ParseMediaType(contenttype); err != nil {
+		t.Fatal(err)
+	}
+	reader = multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		if part, err = reader.NextPart(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, part.FormName())
+	}
+}
+
+func TestMultipartLength(t *testing.T) {
+	var files []fetchFile = []fetchFile{
+		newFetchFile("a.txt", strings.NewReader("content of a"), nil),
+		newFetchFile("b.txt", bytes.NewReader([]byte("b")), nil),
+	}
+	var targets []byte = []byte(`[{"destination":{"type":"hdas"}}]`)
+	var buffer bytes.Buffer
+	var length int64
+	var err error
+
+	if length, err = multipartLength("boundary", "h1", targets, files); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := multipart.NewWriter(&buffer)
+	if err = writer.SetBoundary("boundary"); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFetchForm(writer, "h1", targets, files, true); err != nil {
+		t.Fatal(err)
+	}
+	if length != int64(buffer.Len()) {
+		t.Errorf("multipartLength: expected %d, got %d", buffer.Len(), length)
+	}
+}
+
+func TestMultipartLengthUnknownSize(t *testing.T) {
+	var files []fetchFile = []fetchFile{
+		newFetchFile("a.txt", io.MultiReader(strings.NewReader("a")), nil),
+	}
+	var length int64
+	var err error
+
+	if length, err = multipartLength("boundary", "h1", []byte("[]"), files); err != nil {
+		t.Fatal(err)
+	}
+	if length != -1 {
+		t.Errorf("multipartLength: expected -1 for unknown size, got %d", length)
+	}
+}
+
+func TestFetchMultipartContentLength(t *testing.T) {
+	var server *httptest.Server = newFetchServer(t, false)
+	var g *Galaxy
+	var progress []UploadProgress
+	var fileid string
+	var err error
+
+	defer server.Close()
+	g = NewGalaxy(server.URL, "key", false)
+
+	fileid, _, err = g.UploadReader("h1", "a.txt", strings.NewReader(strings.Repeat("x", 100000)), "txt",
+		&UploadOptions{Progress: func(p UploadProgress) { progress = append(progress, p) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileid != "d1" {
+		t.Errorf("Expected file id d1, got %s", fileid)
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Sent != 100000 {
+		t.Errorf("Expected final progress of 100000 bytes, got %v", progress)
+	}
+}
+
+func TestFetchMultipartChunked(t *testing.T) {
+	var server *httptest.Server = newFetchServer(t, true)
+	var g *Galaxy
+	var err error
+
+	defer server.Close()
+	g = NewGalaxy(server.URL, "key", false)
+
+	if _, _, err = g.UploadReader("h1", "a.txt", io.MultiReader(strings.NewReader("content")), "txt", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The server answers before reading the body: The upload must end without
+// blocking, and progress must not be reported concurrently (go test -race)
+func TestFetchMultipartEarlyAnswer(t *testing.T) {
+	var server *httptest.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"err_msg":"Rejected","err_code":400}`))
+	}))
+	var g *Galaxy
+	var err error
+
+	defer server.Close()
+	g = NewGalaxy(server.URL, "key", false)
+
+	_, _, err = g.UploadReader("h1", "a.txt", strings.NewReader(strings.Repeat("x", 10<<20)), "txt",
+		&UploadOptions{Progress: func(p UploadProgress) {}})
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}